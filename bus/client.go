@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net"
+	"time"
 )
 
 const (
@@ -11,16 +12,41 @@ const (
 	PUSH_PORT = ":8005"
 )
 
+// Command is the `cmd` of a message sent on the bus
+type Command string
+
+const (
+	//CmdStop stops the task's running instances
+	CmdStop Command = "stop"
+	//CmdDisable stops the task and disables it until it is enabled again
+	CmdDisable Command = "disable"
+	//CmdDelete stops the task and deletes it
+	CmdDelete Command = "delete"
+	//CmdPause suspends the task's schedule, optionally until a given time
+	CmdPause Command = "pause"
+	//CmdResume resumes a paused task's schedule
+	CmdResume Command = "resume"
+	//CmdRun runs the task immediately
+	CmdRun Command = "run"
+	//CmdPublish publishes an event
+	CmdPublish Command = "publish"
+)
+
 type BusClient struct{}
 type Message map[string]string
 
-func newMessage(cmd string, taskID string) Message {
+func newMessage(cmd Command, taskID string) Message {
 	msg := make(map[string]string)
-	msg["cmd"] = cmd
+	msg["cmd"] = string(cmd)
 	msg["taskID"] = taskID
 	return msg
 }
 
+// Command returns the message's command
+func (m Message) Command() Command {
+	return Command(m["cmd"])
+}
+
 func NewBusClient() *BusClient {
 	return &BusClient{}
 }
@@ -46,14 +72,110 @@ func (c *BusClient) Push(message Message) error {
 	defer conn.Close()
 	return nil
 }
-func (c *BusClient) StopTask(taskId string, disable bool, delete bool) error {
-	var msg Message
-	if disable {
-		msg = newMessage("disable", taskId)
-	} else if delete {
-		msg = newMessage("delete", taskId)
-	} else {
-		msg = newMessage("stop", taskId)
+
+/*
+Publish publishes the event called event with payload, running the tasks
+subscribed to it e.g those scheduled with tasks.NewSchedule().OnEvent(event)
+*/
+func (c *BusClient) Publish(event string, payload map[string]string) error {
+	if len(event) == 0 {
+		return fmt.Errorf("event name is required")
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshall payload: %v", err)
+	}
+	msg := Message{
+		"cmd":     string(CmdPublish),
+		"event":   event,
+		"payload": string(data),
 	}
 	return c.Push(msg)
 }
+
+/*
+EventPayload decodes the payload of a message sent by Publish
+*/
+func (m Message) EventPayload() (map[string]string, error) {
+	return m.decode("payload")
+}
+
+/*
+RunNow runs the task with the provided taskID immediately, outside of its schedule.
+params are passed to the task's function, see tasks.RunParams
+*/
+func (c *BusClient) RunNow(taskID string, params map[string]string) error {
+	msg := newMessage(CmdRun, taskID)
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshall params: %v", err)
+	}
+	msg["params"] = string(data)
+	return c.Push(msg)
+}
+
+/*
+Params decodes the params of a message sent by RunNow
+*/
+func (m Message) Params() (map[string]string, error) {
+	return m.decode("params")
+}
+
+// decode decodes the JSON object stored under key
+func (m Message) decode(key string) (map[string]string, error) {
+	values := make(map[string]string)
+	if len(m[key]) == 0 || m[key] == "null" {
+		return values, nil
+	}
+	if err := json.Unmarshal([]byte(m[key]), &values); err != nil {
+		return nil, fmt.Errorf("invalid %v: %v", key, err)
+	}
+	return values, nil
+}
+
+/*
+StopTask stops the task with the provided taskId, cmd being one of
+CmdStop, CmdDisable or CmdDelete. Use Pause to stop a task temporarily.
+*/
+func (c *BusClient) StopTask(taskId string, cmd Command) error {
+	switch cmd {
+	case CmdStop, CmdDisable, CmdDelete:
+		return c.Push(newMessage(cmd, taskId))
+	}
+	return fmt.Errorf("invalid stop command: %q", cmd)
+}
+
+/*
+Pause suspends the schedule of the task with the provided taskID until the
+provided time, or until Resume is called if until is nil. Running instances
+are not stopped.
+*/
+func (c *BusClient) Pause(taskID string, until *time.Time) error {
+	msg := newMessage(CmdPause, taskID)
+	if until != nil {
+		msg["until"] = until.Format(time.RFC3339)
+	}
+	return c.Push(msg)
+}
+
+/*
+Resume resumes the schedule of the task with the provided taskID, see Pause
+*/
+func (c *BusClient) Resume(taskID string) error {
+	return c.Push(newMessage(CmdResume, taskID))
+}
+
+/*
+Until decodes the time a message sent by Pause pauses the task until,
+nil when the task is paused until it is resumed
+*/
+func (m Message) Until() (*time.Time, error) {
+	if len(m["until"]) == 0 {
+		return nil, nil
+	}
+	until, err := time.Parse(time.RFC3339, m["until"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid until: %v", err)
+	}
+	return &until, nil
+}
@@ -0,0 +1,205 @@
+package calendars
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aodr3w/keiji-core/common"
+	"github.com/aodr3w/keiji-core/db"
+	"github.com/aodr3w/keiji-core/dto"
+	"github.com/aodr3w/keiji-core/paths"
+	"github.com/aodr3w/keiji-core/utils"
+)
+
+const icsDateLayout = "20060102"
+
+// extensions checked, in order, when looking up a calendar by name in the workspace
+var extensions = []string{".ics", ".txt", ""}
+
+/*
+Find returns the path of the calendar file called name in the workspace
+calendars directory e.g ~/keiji/calendars/ke-public-holidays.ics
+*/
+func Find(name string) (string, error) {
+	for _, ext := range extensions {
+		path := filepath.Join(paths.CALENDARS_PATH, name+ext)
+		if ok, err := utils.PathExists(path); err != nil {
+			return "", err
+		} else if ok {
+			return path, nil
+		}
+	}
+	return "", common.NewPathNotFound(filepath.Join(paths.CALENDARS_PATH, name))
+}
+
+/*
+Load reads the calendar stored at path. `.ics` files are parsed as
+iCalendar files, all other files as date lists. The calendar is named
+after the file e.g ke-public-holidays.ics -> ke-public-holidays
+*/
+func Load(path string) (*dto.Calendar, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	ext := filepath.Ext(path)
+	name := strings.TrimSuffix(filepath.Base(path), ext)
+	if strings.EqualFold(ext, ".ics") {
+		return ParseICS(name, file)
+	}
+	return ParseDateList(name, file)
+}
+
+/*
+LoadWorkspace loads every calendar in the workspace calendars directory
+*/
+func LoadWorkspace() ([]*dto.Calendar, error) {
+	entries, err := os.ReadDir(paths.CALENDARS_PATH)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	calendars := make([]*dto.Calendar, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		cal, err := Load(filepath.Join(paths.CALENDARS_PATH, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, cal)
+	}
+	return calendars, nil
+}
+
+/*
+Sync loads the workspace calendar called name and saves it through repo,
+so the scheduler and any UI see the same dates
+*/
+func Sync(repo *db.Repo, name string) error {
+	path, err := Find(name)
+	if err != nil {
+		return err
+	}
+	cal, err := Load(path)
+	if err != nil {
+		return err
+	}
+	return repo.SaveCalendar(&db.CalendarModel{
+		Name:   cal.Name,
+		Dates:  cal.Dates,
+		Source: path,
+	})
+}
+
+/*
+ParseDateList parses a list of dates, one per line in format 2006-01-02.
+Empty lines and lines starting with # are ignored.
+*/
+func ParseDateList(name string, r io.Reader) (*dto.Calendar, error) {
+	var dates []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dates = append(dates, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return dto.NewCalendar(name, dates)
+}
+
+/*
+ParseICS parses the events of an iCalendar file into a calendar. Every
+date covered by an event is excluded; recurrence rules (RRULE) are not
+expanded so recurring holidays should be exported as individual events.
+*/
+func ParseICS(name string, r io.Reader) (*dto.Calendar, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var dates []string
+	var inEvent bool
+	var start, end string
+	for _, line := range lines {
+		prop, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		//drop parameters e.g DTSTART;VALUE=DATE
+		prop, _, _ = strings.Cut(strings.ToUpper(prop), ";")
+		switch {
+		case prop == "BEGIN" && strings.EqualFold(value, "VEVENT"):
+			inEvent = true
+			start, end = "", ""
+		case prop == "END" && strings.EqualFold(value, "VEVENT"):
+			inEvent = false
+			eventDates, err := expandEvent(start, end)
+			if err != nil {
+				return nil, fmt.Errorf("calendar %v: %v", name, err)
+			}
+			dates = append(dates, eventDates...)
+		case inEvent && prop == "DTSTART":
+			start = value
+		case inEvent && prop == "DTEND":
+			end = value
+		}
+	}
+	return dto.NewCalendar(name, dates)
+}
+
+// unfold joins iCalendar content lines that were split across several lines
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// expandEvent returns every date from start up to, but excluding, end.
+// An event without an end covers its start date only.
+func expandEvent(start string, end string) ([]string, error) {
+	if len(start) < len(icsDateLayout) {
+		return nil, fmt.Errorf("invalid DTSTART %q", start)
+	}
+	from, err := time.Parse(icsDateLayout, start[:len(icsDateLayout)])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DTSTART %q", start)
+	}
+	dates := []string{from.Format(dto.CalendarDateLayout)}
+	if len(end) < len(icsDateLayout) {
+		return dates, nil
+	}
+	to, err := time.Parse(icsDateLayout, end[:len(icsDateLayout)])
+	if err != nil {
+		return nil, fmt.Errorf("invalid DTEND %q", end)
+	}
+	//timed events that end after midnight also cover their end date
+	if len(end) > len(icsDateLayout) && !strings.HasPrefix(end[len(icsDateLayout):], "T000000") {
+		to = to.AddDate(0, 0, 1)
+	}
+	for d := from.AddDate(0, 0, 1); d.Before(to); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format(dto.CalendarDateLayout))
+	}
+	return dates, nil
+}
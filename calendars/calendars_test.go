@@ -0,0 +1,77 @@
+package calendars
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		file  string
+		dates []string
+	}{
+		{
+			file: "holidays.ics",
+			dates: []string{
+				//all day event
+				"2026-01-01",
+				//multi day event, DTEND is exclusive
+				"2026-04-03", "2026-04-04", "2026-04-05", "2026-04-06",
+				//event without DTEND
+				"2026-06-01",
+				//timed event ending after midnight covers its end date
+				"2026-10-19", "2026-10-20",
+				//timed event ending at midnight does not
+				"2026-12-01",
+				//folded lines
+				"2026-12-25", "2026-12-26",
+			},
+		},
+		{
+			file:  "holidays.txt",
+			dates: []string{"2026-01-01", "2026-06-01"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			cal, err := Load(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cal.Name != "holidays" {
+				t.Errorf("calendar name = %q, want holidays", cal.Name)
+			}
+			if fmt.Sprint(cal.Dates) != fmt.Sprint(tt.dates) {
+				t.Errorf("dates = %v, want %v", cal.Dates, tt.dates)
+			}
+		})
+	}
+}
+
+func TestParseICSErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		event string
+	}{
+		{"missing start", "SUMMARY:no start"},
+		{"short start", "DTSTART:2026"},
+		{"invalid start", "DTSTART:2026AB01"},
+		{"invalid end", "DTSTART:20260101\nDTEND:2026AB02"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ics := "BEGIN:VCALENDAR\nBEGIN:VEVENT\n" + tt.event + "\nEND:VEVENT\nEND:VCALENDAR\n"
+			if _, err := ParseICS("broken", strings.NewReader(ics)); err == nil {
+				t.Fatal("ParseICS succeeded")
+			}
+		})
+	}
+}
+
+func TestParseDateListErrors(t *testing.T) {
+	if _, err := ParseDateList("broken", strings.NewReader("2026-01-01\n01/02/2026\n")); err == nil {
+		t.Fatal("ParseDateList accepted a date in the wrong format")
+	}
+}
@@ -24,3 +24,25 @@ func NewPathNotFound(path string) *PathNotFound {
 var ErrPathNotFound = func(msg string) *PathNotFound {
 	return NewPathNotFound(msg)
 }
+
+/*
+InvalidScheduleError is returned when a task's schedule definition
+is invalid e.g a malformed time string or a non positive interval
+*/
+type InvalidScheduleError struct {
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e *InvalidScheduleError) Error() string {
+	return fmt.Sprintf("invalid schedule %v %q: %v", e.Field, e.Value, e.Reason)
+}
+
+func NewInvalidScheduleError(field string, value interface{}, reason string) *InvalidScheduleError {
+	return &InvalidScheduleError{
+		Field:  field,
+		Value:  fmt.Sprint(value),
+		Reason: reason,
+	}
+}
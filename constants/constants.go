@@ -15,3 +15,6 @@ var (
 	TCP_BUS   Service = "bus"
 	SERVICES          = []Service{TCP_BUS, SCHEDULER}
 )
+
+// TRIGGER_PATH_ENV is the environment variable holding the path of the file that triggered a FileWatch task's run
+const TRIGGER_PATH_ENV = "KEIJI_TRIGGER_PATH"
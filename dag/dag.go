@@ -0,0 +1,178 @@
+package dag
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+/*
+CycleError is returned when dependencies form a cycle, Path starts
+and ends with the same task e.g [a b a] where b runs after a and a after b
+*/
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle: %v", strings.Join(e.Path, " -> "))
+}
+
+/*
+Run is the latest finished run of a task, used to decide if its dependents may run
+*/
+type Run struct {
+	Succeeded bool
+	StartedAt time.Time
+	EndedAt   time.Time
+}
+
+// graph returns the downstream tasks of each task, sorted so results are deterministic
+func graph(deps []dto.Dependency) (map[string][]string, []string) {
+	edges := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, dep := range deps {
+		edges[dep.Upstream] = append(edges[dep.Upstream], dep.Task)
+		seen[dep.Upstream] = true
+		seen[dep.Task] = true
+	}
+	nodes := make([]string, 0, len(seen))
+	for node := range seen {
+		nodes = append(nodes, node)
+	}
+	slices.Sort(nodes)
+	for node := range edges {
+		slices.Sort(edges[node])
+		edges[node] = slices.Compact(edges[node])
+	}
+	return edges, nodes
+}
+
+/*
+FindCycle returns a cycle in deps as a *CycleError, nil if there is none
+*/
+func FindCycle(deps []dto.Dependency) error {
+	edges, nodes := graph(deps)
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(nodes))
+	var path []string
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		path = append(path, node)
+		for _, next := range edges[node] {
+			switch state[next] {
+			case visiting:
+				start := slices.Index(path, next)
+				return append(slices.Clone(path[start:]), next)
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = visited
+		return nil
+	}
+	for _, node := range nodes {
+		if state[node] == unvisited {
+			if cycle := visit(node); cycle != nil {
+				return &CycleError{Path: cycle}
+			}
+		}
+	}
+	return nil
+}
+
+/*
+TopologicalOrder returns every task referenced by deps ordered so that each
+task comes after all of its upstream tasks. Tasks that do not depend on each
+other are ordered by name. A *CycleError is returned if deps form a cycle.
+*/
+func TopologicalOrder(deps []dto.Dependency) ([]string, error) {
+	if err := FindCycle(deps); err != nil {
+		return nil, err
+	}
+	edges, nodes := graph(deps)
+	indegree := make(map[string]int, len(nodes))
+	for _, downstream := range edges {
+		for _, node := range downstream {
+			indegree[node]++
+		}
+	}
+	var ready []string
+	for _, node := range nodes {
+		if indegree[node] == 0 {
+			ready = append(ready, node)
+		}
+	}
+	order := make([]string, 0, len(nodes))
+	for len(ready) > 0 {
+		node := ready[0]
+		ready = ready[1:]
+		order = append(order, node)
+		var released []string
+		for _, next := range edges[node] {
+			indegree[next]--
+			if indegree[next] == 0 {
+				released = append(released, next)
+			}
+		}
+		ready = append(ready, released...)
+		slices.Sort(ready)
+	}
+	return order, nil
+}
+
+/*
+Downstream returns the tasks that may run now that upstream finished, succeeded
+being its outcome. latest holds the latest finished run of each task by name.
+A task depending on success runs once each of its upstream tasks has succeeded
+since the task last started, a task depending on failure runs when any fails.
+*/
+func Downstream(deps []dto.Dependency, upstream string, succeeded bool, latest map[string]Run) []string {
+	var runnable []string
+	for _, dep := range deps {
+		if dep.Upstream != upstream || slices.Contains(runnable, dep.Task) {
+			continue
+		}
+		switch dep.Condition {
+		case dto.DependsOnFailure:
+			if !succeeded {
+				runnable = append(runnable, dep.Task)
+			}
+		case dto.DependsOnSuccess, "":
+			if succeeded && upstreamSucceeded(deps, dep.Task, upstream, latest) {
+				runnable = append(runnable, dep.Task)
+			}
+		}
+	}
+	slices.Sort(runnable)
+	return runnable
+}
+
+// upstreamSucceeded reports wether every upstream task of task other than finished succeeded since task last started
+func upstreamSucceeded(deps []dto.Dependency, task string, finished string, latest map[string]Run) bool {
+	last, ran := latest[task]
+	for _, dep := range deps {
+		if dep.Task != task || dep.Upstream == finished {
+			continue
+		}
+		run, ok := latest[dep.Upstream]
+		if !ok || !run.Succeeded {
+			return false
+		}
+		if ran && !run.EndedAt.After(last.StartedAt) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,161 @@
+package dag
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+// edge returns a dependency of task on upstream's success
+func edge(task string, upstream string) dto.Dependency {
+	return dto.Dependency{Task: task, Upstream: upstream, Condition: dto.DependsOnSuccess}
+}
+
+func TestFindCycle(t *testing.T) {
+	tests := []struct {
+		name string
+		deps []dto.Dependency
+		want []string
+	}{
+		{"none", nil, nil},
+		{"chain", []dto.Dependency{edge("b", "a"), edge("c", "b")}, nil},
+		{"diamond", []dto.Dependency{edge("b", "a"), edge("c", "a"), edge("d", "b"), edge("d", "c")}, nil},
+		{"self", []dto.Dependency{edge("a", "a")}, []string{"a", "a"}},
+		{"pair", []dto.Dependency{edge("b", "a"), edge("a", "b")}, []string{"a", "b", "a"}},
+		{"behind a chain", []dto.Dependency{edge("b", "a"), edge("c", "b"), edge("d", "c"), edge("b", "d")}, []string{"b", "c", "d", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FindCycle(tt.deps)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("FindCycle = %v, want nil", err)
+				}
+				return
+			}
+			var cycle *CycleError
+			if !errors.As(err, &cycle) {
+				t.Fatalf("FindCycle = %v, want a *CycleError", err)
+			}
+			if fmt.Sprint(cycle.Path) != fmt.Sprint(tt.want) {
+				t.Errorf("cycle = %v, want %v", cycle.Path, tt.want)
+			}
+		})
+	}
+}
+
+func TestTopologicalOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		deps []dto.Dependency
+		want []string
+	}{
+		{"chain", []dto.Dependency{edge("c", "b"), edge("b", "a")}, []string{"a", "b", "c"}},
+		{"independent tasks by name", []dto.Dependency{edge("z", "y"), edge("b", "a")}, []string{"a", "b", "y", "z"}},
+		{"diamond", []dto.Dependency{edge("d", "b"), edge("d", "c"), edge("b", "a"), edge("c", "a")}, []string{"a", "b", "c", "d"}},
+		{"duplicate edges", []dto.Dependency{edge("b", "a"), edge("b", "a")}, []string{"a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := TopologicalOrder(tt.deps)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(order) != fmt.Sprint(tt.want) {
+				t.Errorf("TopologicalOrder = %v, want %v", order, tt.want)
+			}
+		})
+	}
+	var cycle *CycleError
+	if _, err := TopologicalOrder([]dto.Dependency{edge("a", "b"), edge("b", "a")}); !errors.As(err, &cycle) {
+		t.Fatalf("TopologicalOrder of a cycle = %v, want a *CycleError", err)
+	}
+}
+
+func TestDownstream(t *testing.T) {
+	start := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	run := func(succeeded bool, startMin, endMin int) Run {
+		return Run{
+			Succeeded: succeeded,
+			StartedAt: start.Add(time.Duration(startMin) * time.Minute),
+			EndedAt:   start.Add(time.Duration(endMin) * time.Minute),
+		}
+	}
+	join := []dto.Dependency{edge("report", "extract"), edge("report", "load")}
+	onFailure := dto.Dependency{Task: "alert", Upstream: "extract", Condition: dto.DependsOnFailure}
+	tests := []struct {
+		name      string
+		deps      []dto.Dependency
+		succeeded bool
+		latest    map[string]Run
+		want      []string
+	}{
+		{
+			name:      "single upstream succeeded",
+			deps:      []dto.Dependency{edge("load", "extract")},
+			succeeded: true,
+			latest:    map[string]Run{"extract": run(true, 0, 5)},
+			want:      []string{"load"},
+		},
+		{
+			name:      "single upstream failed",
+			deps:      []dto.Dependency{edge("load", "extract")},
+			succeeded: false,
+			latest:    map[string]Run{"extract": run(false, 0, 5)},
+			want:      nil,
+		},
+		{
+			name:      "join waits for the other upstream",
+			deps:      join,
+			succeeded: true,
+			latest:    map[string]Run{"extract": run(true, 0, 5)},
+			want:      nil,
+		},
+		{
+			name:      "join runs once every upstream succeeded",
+			deps:      join,
+			succeeded: true,
+			latest:    map[string]Run{"extract": run(true, 0, 5), "load": run(true, 0, 3)},
+			want:      []string{"report"},
+		},
+		{
+			name:      "join ignores upstream runs from before its last run",
+			deps:      join,
+			succeeded: true,
+			latest:    map[string]Run{"extract": run(true, 20, 25), "load": run(true, 0, 3), "report": run(true, 10, 12)},
+			want:      nil,
+		},
+		{
+			name:      "join ignores a failed upstream",
+			deps:      join,
+			succeeded: true,
+			latest:    map[string]Run{"extract": run(true, 0, 5), "load": run(false, 0, 3)},
+			want:      nil,
+		},
+		{
+			name:      "failure condition",
+			deps:      append([]dto.Dependency{edge("load", "extract")}, onFailure),
+			succeeded: false,
+			latest:    map[string]Run{"extract": run(false, 0, 5)},
+			want:      []string{"alert"},
+		},
+		{
+			name:      "failure condition on success",
+			deps:      []dto.Dependency{onFailure},
+			succeeded: true,
+			latest:    map[string]Run{"extract": run(true, 0, 5)},
+			want:      nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Downstream(tt.deps, "extract", tt.succeeded, tt.latest)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("Downstream = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -73,5 +73,19 @@ func (dbBackend *DatabaseBackend) AutoMigrate() error {
 			}
 		}
 	}()
-	return db.AutoMigrate(&TaskModel{}, &UserModel{})
+	if err := db.AutoMigrate(&TaskModel{}, &UserModel{}, &CalendarModel{}, &TaskRunModel{}, &TaskDependencyModel{}, &EventSubscriptionModel{}); err != nil {
+		return err
+	}
+	return backfillTaskStatus(db)
+}
+
+/*
+backfillTaskStatus sets the status of tasks stored before TaskStatus
+was introduced from their status booleans
+*/
+func backfillTaskStatus(db *gorm.DB) error {
+	return db.Model(&TaskModel{}).Where("status IS NULL OR status = ?", "").Update("status", gorm.Expr(
+		"CASE WHEN is_disabled THEN ? WHEN is_completed THEN ? WHEN is_error THEN ? WHEN is_running THEN ? WHEN is_queued THEN ? ELSE ? END",
+		StatusDisabled, StatusCompleted, StatusFailed, StatusRunning, StatusQueued, StatusIdle,
+	)).Error
 }
@@ -2,18 +2,68 @@ package db
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
+	"github.com/aodr3w/keiji-core/dto"
 	"gorm.io/gorm"
 )
 
+/*
+TaskStatus is the state of a task, see Repo.Transition for the allowed moves.
+The IsRunning, IsQueued, IsError, IsDisabled and IsCompleted fields are derived from it.
+*/
 type TaskStatus string
 
+const (
+	StatusIdle      TaskStatus = "idle"
+	StatusQueued    TaskStatus = "queued"
+	StatusRunning   TaskStatus = "running"
+	StatusSucceeded TaskStatus = "succeeded"
+	StatusFailed    TaskStatus = "failed"
+	StatusDisabled  TaskStatus = "disabled"
+	StatusCompleted TaskStatus = "completed"
+)
+
+// transitions lists the statuses each status may move to
+var transitions = map[TaskStatus][]TaskStatus{
+	StatusIdle:      {StatusQueued, StatusRunning, StatusDisabled, StatusCompleted},
+	StatusQueued:    {StatusIdle, StatusRunning, StatusDisabled},
+	StatusRunning:   {StatusIdle, StatusSucceeded, StatusFailed, StatusDisabled, StatusCompleted},
+	StatusSucceeded: {StatusIdle, StatusQueued, StatusRunning, StatusDisabled, StatusCompleted},
+	StatusFailed:    {StatusIdle, StatusQueued, StatusRunning, StatusDisabled, StatusCompleted},
+	StatusDisabled:  {StatusIdle},
+	StatusCompleted: {StatusIdle, StatusDisabled},
+}
+
+// CanTransition returns true if a task may move from status s to status to
+func (s TaskStatus) CanTransition(to TaskStatus) bool {
+	for _, allowed := range transitions[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValid returns true if s is one of the known statuses
+func (s TaskStatus) IsValid() bool {
+	_, ok := transitions[s]
+	return ok
+}
+
 type TaskType string
 
 const (
-	HMSTask     TaskType = "HMS"
-	DayTimeTask TaskType = "DayTime"
+	HMSTask       TaskType = "HMS"
+	DayTimeTask   TaskType = "DayTime"
+	CronTask      TaskType = "Cron"
+	MonthlyTask   TaskType = "Monthly"
+	YearlyTask    TaskType = "Yearly"
+	OnceTask      TaskType = "Once"
+	DependentTask TaskType = "Dependent"
+	EventTask     TaskType = "Event"
+	FileWatchTask TaskType = "FileWatch"
 )
 
 type UserModel struct {
@@ -25,24 +75,155 @@ type UserModel struct {
 
 type TaskModel struct {
 	gorm.Model
-	TaskId            string                 `gorm:"unique" json:"taskId"`
-	Name              string                 `gorm:"unique" json:"name"`
-	Description       string                 `gorm:"varchar(15)" json:"description"`
-	ScheduleInfo      map[string]interface{} `gorm:"json" json:"scheduleInfo"`
-	Schedule          string                 `gorm:"varchar(20)" json:"schedule"`
-	LastExecutionTime *time.Time             `json:"lastExecutionTime"`
-	NextExecutionTime *time.Time             `json:"nextExecutionTime"`
-	LogPath           string                 `json:"logPath"`
-	Slug              string                 `gorm:"unique" json:"slug"`
+	TaskId            string                `gorm:"unique" json:"taskId"`
+	Name              string                `gorm:"unique" json:"name"`
+	Description       string                `gorm:"varchar(15)" json:"description"`
+	ScheduleInfo      dto.ScheduleSpec      `gorm:"serializer:json" json:"scheduleInfo"`
+	Schedule          string                `gorm:"varchar(20)" json:"schedule"`
+	LastExecutionTime *time.Time            `json:"lastExecutionTime"`
+	NextExecutionTime *time.Time            `json:"nextExecutionTime"`
+	MisfirePolicy     dto.MisfirePolicy     `gorm:"serializer:json" json:"misfirePolicy"`
+	ConcurrencyPolicy dto.ConcurrencyPolicy `json:"concurrencyPolicy"`
+	MaxConcurrent     int                   `json:"maxConcurrent"`
+	RunningCount      int                   `json:"runningCount"`
+	Timeout           time.Duration         `json:"timeout"`
+	RetryPolicy       *dto.RetryPolicySpec  `gorm:"serializer:json" json:"retryPolicy"`
+	LogPath           string                `json:"logPath"`
+	Slug              string                `gorm:"unique" json:"slug"`
 	Type              TaskType
 	Executable        string
 	IsRunning         bool
 	IsQueued          bool
 	IsError           bool
 	IsDisabled        bool
-	ErrorTxt          string
+	IsCompleted       bool
+	//IsPaused & PausedUntil suspend the task's schedule, see Repo.PauseTask
+	IsPaused    bool       `json:"isPaused"`
+	PausedUntil *time.Time `json:"pausedUntil"`
+	//ResumedAt is when the task was last resumed, runs scheduled before it were skipped
+	ResumedAt *time.Time `json:"resumedAt"`
+	Status    TaskStatus `gorm:"index" json:"status"`
+	//LeaseOwner is the scheduler instance that claimed the task, see Repo.ClaimDueTasks
+	LeaseOwner     string     `gorm:"index" json:"leaseOwner"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt"`
+	ErrorTxt       string
+}
+
+/*
+CalendarModel stores a named set of excluded dates (in dto.CalendarDateLayout)
+that schedules can reference e.g public holidays
+*/
+type CalendarModel struct {
+	gorm.Model
+	Name   string   `gorm:"unique" json:"name"`
+	Dates  []string `gorm:"serializer:json" json:"dates"`
+	Source string   `json:"source"`
+}
+
+// Calendar returns the calendar's dates as a *dto.Calendar
+func (c *CalendarModel) Calendar() (*dto.Calendar, error) {
+	return dto.NewCalendar(c.Name, c.Dates)
+}
+
+/*
+TaskDependencyModel stores an edge of a workflow, the task called TaskName
+runs after the task called UpstreamName, see Repo.SetDependencies
+*/
+type TaskDependencyModel struct {
+	gorm.Model
+	TaskName     string                  `gorm:"uniqueIndex:idx_task_upstream" json:"taskName"`
+	UpstreamName string                  `gorm:"uniqueIndex:idx_task_upstream;index" json:"upstreamName"`
+	Condition    dto.DependencyCondition `json:"condition"`
+}
+
+// Dependency returns the edge as a dto.Dependency
+func (d *TaskDependencyModel) Dependency() dto.Dependency {
+	return dto.Dependency{
+		Task:      d.TaskName,
+		Upstream:  d.UpstreamName,
+		Condition: d.Condition,
+	}
+}
+
+/*
+EventSubscriptionModel subscribes the task called TaskName to the
+event called Event, see Repo.SetSubscriptions
+*/
+type EventSubscriptionModel struct {
+	gorm.Model
+	Event    string `gorm:"uniqueIndex:idx_event_task" json:"event"`
+	TaskName string `gorm:"uniqueIndex:idx_event_task;index" json:"taskName"`
+}
+
+/*
+RunTrigger records what started a task run
+*/
+type RunTrigger string
+
+const (
+	//TriggerSchedule the run was due according to the task's schedule
+	TriggerSchedule RunTrigger = "schedule"
+	//TriggerMisfire the run was owed after the scheduler missed it
+	TriggerMisfire RunTrigger = "misfire"
+	//TriggerRetry the run retries a failed run according to the task's retry policy
+	TriggerRetry RunTrigger = "retry"
+	//TriggerEvent the run was started by an event published on the bus
+	TriggerEvent RunTrigger = "event"
+	//TriggerUpstream the run was started by an upstream task finishing
+	TriggerUpstream RunTrigger = "upstream"
+	//TriggerFile the run was started by a change to a watched file
+	TriggerFile RunTrigger = "file"
+	//TriggerManual the run was requested through the bus, see bus.BusClient.RunNow
+	TriggerManual RunTrigger = "manual"
+)
+
+/*
+TaskRunModel records a single run (attempt) of a task, see Repo.StartTaskRun
+*/
+type TaskRunModel struct {
+	gorm.Model
+	RunId     string     `gorm:"unique" json:"runId"`
+	TaskId    string     `gorm:"index" json:"taskId"`
+	Trigger   RunTrigger `json:"trigger"`
+	Attempt   int        `json:"attempt"`
+	StartedAt time.Time  `gorm:"index" json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	//Duration is set once the run finishes
+	Duration time.Duration `json:"duration"`
+	//ExitCode is nil while the run is in progress
+	ExitCode *int   `json:"exitCode"`
+	ErrorTxt string `json:"errorTxt"`
+	//LogOffset is the size of the task's log file when the run started,
+	//i.e where the run's output begins
+	LogOffset int64 `json:"logOffset"`
+}
+
+// IsFinished returns true once FinishTaskRun has been called for the run
+func (r *TaskRunModel) IsFinished() bool {
+	return r.EndedAt != nil
+}
+
+// Succeeded returns true if the run finished with exit code 0
+func (r *TaskRunModel) Succeeded() bool {
+	return r.ExitCode != nil && *r.ExitCode == 0
 }
 
+/*
+RunDecision is the outcome of Repo.AcquireRunSlot for a run that is due
+*/
+type RunDecision string
+
+const (
+	//RunStart the run may start
+	RunStart RunDecision = "start"
+	//RunSkip the run should be dropped
+	RunSkip RunDecision = "skip"
+	//RunReplace the running instances should be stopped before the run starts
+	RunReplace RunDecision = "replace"
+	//RunQueue the run should start once a running instance finishes
+	RunQueue RunDecision = "queue"
+)
+
 // Implement the Stringer interface for TaskModel
 func (t TaskModel) String() string {
 	lastExecution := "N/A"
@@ -72,13 +253,196 @@ func (t TaskModel) String() string {
 			"IsQueued: %t\n"+
 			"IsError: %t\n"+
 			"IsDisabled: %t\n"+
+			"IsCompleted: %t\n"+
+			"IsPaused: %t\n"+
+			"Status: %s\n"+
 			"ErrorTxt: %s\n",
-		t.ID, t.TaskId, t.Name, t.Description, t.Schedule, lastExecution, nextExecution, t.LogPath, t.Slug, t.Type, t.Executable, t.IsRunning, t.IsQueued, t.IsError, t.IsDisabled, t.ErrorTxt,
+		t.ID, t.TaskId, t.Name, t.Description, t.Schedule, lastExecution, nextExecution, t.LogPath, t.Slug, t.Type, t.Executable, t.IsRunning, t.IsQueued, t.IsError, t.IsDisabled, t.IsCompleted, t.IsPaused, t.Status, t.ErrorTxt,
 	)
 }
 
+/*
+IsActive returns true if t falls inside the task's active window
+(ScheduleInfo.StartAt, ScheduleInfo.EndAt) and outside all of its blackout periods
+*/
+func (t *TaskModel) IsActive(at time.Time) bool {
+	window := t.ScheduleInfo
+	if window.StartAt != nil && at.Before(*window.StartAt) {
+		return false
+	}
+	if window.EndAt != nil && !at.Before(*window.EndAt) {
+		return false
+	}
+	for _, b := range window.Blackouts {
+		if b.Contains(at) {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+RunLimit returns the number of runs of the task that may execute at the same
+time, 0 meaning unlimited
+*/
+func (t *TaskModel) RunLimit() int {
+	switch t.ConcurrencyPolicy {
+	case dto.ConcurrencyAllow:
+		return t.MaxConcurrent
+	case dto.ConcurrencyQueue:
+		return max(t.MaxConcurrent, 1)
+	}
+	return 1
+}
+
+/*
+TaskInfo returns the task's information as a *dto.TaskInfo
+*/
+func (t *TaskModel) TaskInfo() *dto.TaskInfo {
+	info := &dto.TaskInfo{
+		TaskID:            t.TaskId,
+		Name:              t.Name,
+		Description:       t.Description,
+		Schedule:          t.ScheduleInfo,
+		NextExecutionTime: t.NextExecutionTime,
+		LastExecutionTime: t.LastExecutionTime,
+		LogPath:           t.LogPath,
+		Slug:              t.Slug,
+		Type:              string(t.Type),
+		Status:            string(t.Status),
+	}
+	if t.RetryPolicy != nil {
+		info.RetryPolicy = t.RetryPolicy.Map()
+	}
+	return info
+}
+
+/*
+RunArgs returns the command line arguments used to run the
+task's executable e.g [--run --timeout=30m0s]
+*/
+func (t *TaskModel) RunArgs() []string {
+	return t.RunArgsWithParams(nil)
+}
+
+/*
+RunArgsWithParams returns the command line arguments used to run the task's
+executable with params e.g [--run --param date=2024-01-01], see RunArgs
+*/
+func (t *TaskModel) RunArgsWithParams(params map[string]string) []string {
+	args := []string{"--run"}
+	if t.Timeout > 0 {
+		args = append(args, fmt.Sprintf("--timeout=%v", t.Timeout))
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--param", fmt.Sprintf("%s=%s", key, params[key]))
+	}
+	return args
+}
+
+/*
+IsPausedAt returns true if the task's schedule is paused at now,
+a task paused until a given time resumes once it is reached
+*/
+func (t *TaskModel) IsPausedAt(now time.Time) bool {
+	return t.IsPaused && (t.PausedUntil == nil || now.Before(*t.PausedUntil))
+}
+
+/*
+MisfireBaseline returns the time missed runs are counted from, pass it as OwedRuns' lastRun.
+It is the later of LastExecutionTime & ResumedAt so runs that fell inside a pause are skipped
+*/
+func (t *TaskModel) MisfireBaseline() time.Time {
+	var baseline time.Time
+	if t.LastExecutionTime != nil {
+		baseline = *t.LastExecutionTime
+	}
+	if t.ResumedAt != nil && t.ResumedAt.After(baseline) {
+		baseline = *t.ResumedAt
+	}
+	return baseline
+}
+
+// IsLeased returns true if a scheduler instance holds an unexpired lease on the task
+func (t *TaskModel) IsLeased(now time.Time) bool {
+	return t.LeaseOwner != "" && t.LeaseExpiresAt != nil && t.LeaseExpiresAt.After(now)
+}
+
+/*
+statusColumns returns the column values that move a task to status,
+including the status booleans derived from it. The running count is
+left alone, it is only changed by AcquireRunSlot & ReleaseRunSlot so
+a run finishing does not free the slots of runs still in progress.
+*/
+func statusColumns(status TaskStatus) map[string]interface{} {
+	columns := map[string]interface{}{
+		"status":       status,
+		"is_running":   status == StatusRunning,
+		"is_queued":    status == StatusQueued,
+		"is_error":     status == StatusFailed,
+		"is_disabled":  status == StatusDisabled,
+		"is_completed": status == StatusCompleted,
+	}
+	switch status {
+	case StatusSucceeded, StatusCompleted:
+		columns["error_txt"] = ""
+	}
+	if status == StatusCompleted {
+		columns["next_execution_time"] = nil
+	}
+	return columns
+}
+
+/*
+setStatus moves the task to status, updating the derived status booleans,
+see statusColumns
+*/
+func (t *TaskModel) setStatus(status TaskStatus) {
+	t.Status = status
+	t.IsRunning = status == StatusRunning
+	t.IsQueued = status == StatusQueued
+	t.IsError = status == StatusFailed
+	t.IsDisabled = status == StatusDisabled
+	t.IsCompleted = status == StatusCompleted
+	switch status {
+	case StatusSucceeded, StatusCompleted:
+		t.ErrorTxt = ""
+	}
+	if status == StatusCompleted {
+		t.NextExecutionTime = nil
+	}
+}
+
+/*
+statusFromFlags returns the status matching the task's status booleans,
+used for tasks stored before TaskStatus was introduced
+*/
+func (t *TaskModel) statusFromFlags() TaskStatus {
+	switch {
+	case t.IsDisabled:
+		return StatusDisabled
+	case t.IsCompleted:
+		return StatusCompleted
+	case t.IsError:
+		return StatusFailed
+	case t.IsRunning:
+		return StatusRunning
+	case t.IsQueued:
+		return StatusQueued
+	}
+	return StatusIdle
+}
+
 // validation hook
 func (t *TaskModel) BeforeSave(tx *gorm.DB) (err error) {
+	if t.Status == "" {
+		t.Status = t.statusFromFlags()
+	}
 
 	if t.NextExecutionTime != nil {
 		*t.NextExecutionTime = t.NextExecutionTime.Truncate(time.Second)
@@ -4,18 +4,37 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/aodr3w/keiji-core/auth"
+	"github.com/aodr3w/keiji-core/dag"
 	"github.com/aodr3w/keiji-core/dto"
 	"github.com/aodr3w/keiji-core/logging"
 	"github.com/aodr3w/keiji-core/paths"
 	"github.com/aodr3w/keiji-core/utils"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	//ErrIllegalTransition is returned by Transition for a move the task state machine does not allow
+	ErrIllegalTransition = errors.New("illegal task status transition")
+	//ErrStatusConflict is returned by Transition when the task is not in the expected status
+	ErrStatusConflict = errors.New("task status conflict")
+	//ErrLeaseLost is returned when a scheduler instance no longer holds the lease on a task
+	ErrLeaseLost = errors.New("task lease lost")
+)
+
+/*
+LeaseDuration is how long a task claimed through ClaimDueTasks stays
+leased to a scheduler instance unless the lease is renewed
+*/
+var LeaseDuration = 30 * time.Second
+
 type Repo struct {
 	DB     *gorm.DB
 	logger *logging.Logger
@@ -112,6 +131,10 @@ func (r *Repo) SaveTask(task *TaskModel) error {
 
 	if existingTask != nil {
 		r.logger.Info("Task already exists, updating: %v", task.Name)
+		//a completed task becomes runnable again when it is given a new schedule
+		if existingTask.Status == StatusCompleted && !existingTask.ScheduleInfo.Equal(&task.ScheduleInfo) {
+			existingTask.setStatus(StatusIdle)
+		}
 		// Update the existing task fields
 		existingTask.ScheduleInfo = task.ScheduleInfo
 		existingTask.Schedule = task.Schedule
@@ -120,6 +143,11 @@ func (r *Repo) SaveTask(task *TaskModel) error {
 		existingTask.Executable = task.Executable
 		existingTask.NextExecutionTime = task.NextExecutionTime
 		existingTask.LastExecutionTime = task.LastExecutionTime
+		existingTask.MisfirePolicy = task.MisfirePolicy
+		existingTask.ConcurrencyPolicy = task.ConcurrencyPolicy
+		existingTask.MaxConcurrent = task.MaxConcurrent
+		existingTask.Timeout = task.Timeout
+		existingTask.RetryPolicy = task.RetryPolicy
 		existingTask.LogPath = task.LogPath
 		// Update the task in the database
 		if err := tx.Save(existingTask).Error; err != nil {
@@ -148,31 +176,40 @@ func (r *Repo) SaveTask(task *TaskModel) error {
 	return nil
 }
 
-/*HMSScheduleChanged returns true if the schedule info on an HMSTask has changed*/
+/*ScheduleChanged returns true if the schedule info of a task has changed*/
+func (r *Repo) ScheduleChanged(taskInfo *dto.TaskInfo, existingTask *TaskModel) bool {
+	return !taskInfo.Schedule.Equal(&existingTask.ScheduleInfo)
+}
+
+/*
+HMSScheduleChanged returns true if the schedule info on an HMSTask has changed.
+Deprecated: use ScheduleChanged
+*/
 func (r *Repo) HMSScheduleChanged(taskInfo *dto.TaskInfo, existingTask *TaskModel) bool {
-	s1 := taskInfo.Schedule
-	s2 := existingTask.ScheduleInfo
-	return s1["interval"] != s2["interval"]
+	return r.ScheduleChanged(taskInfo, existingTask)
 }
 
-/*DayTimeTaskScheduleChanged returns true if the schedule info on a DayTimeTask has changed*/
+/*
+DayTimeTaskScheduleChanged returns true if the schedule info on a DayTimeTask has changed.
+Deprecated: use ScheduleChanged
+*/
 func (r *Repo) DayTimeTaskScheduleChanged(taskInfo *dto.TaskInfo, existingTask *TaskModel) bool {
-	s1 := taskInfo.Schedule
-	s2 := existingTask.ScheduleInfo
-	return s1["day"] != s2["day"] || s1["time"] != s2["time"]
+	return r.ScheduleChanged(taskInfo, existingTask)
+}
+
+/*IsTaskType returns True if task is of type t*/
+func (r *Repo) IsTaskType(taskInfo *dto.TaskInfo, t TaskType) bool {
+	return taskInfo.Schedule.Type == string(t) || taskInfo.Type == string(t)
 }
 
 /*IsHMSTask returns True if task is of type HMSTask*/
 func (r *Repo) IsHMSTask(taskInfo *dto.TaskInfo) bool {
-	_, ok := taskInfo.Schedule["interval"]
-	return ok || taskInfo.Type == string(HMSTask)
+	return r.IsTaskType(taskInfo, HMSTask)
 }
 
 /*IsDayTimeTask returns True if task is of type DayTime*/
 func (r *Repo) IsDayTimeTask(taskInfo *dto.TaskInfo) bool {
-	_, timeOk := taskInfo.Schedule["time"]
-	_, dayOk := taskInfo.Schedule["day"]
-	return timeOk && dayOk || taskInfo.Type == string(DayTimeTask)
+	return r.IsTaskType(taskInfo, DayTimeTask)
 }
 
 /*
@@ -205,24 +242,34 @@ func (r *Repo) GetTaskByID(taskID string) (*TaskModel, error) {
 }
 
 /*
-ResetIsQueued sets the IsQueued field to false for all tasks in the database
+ResetIsQueued moves all queued tasks back to idle and clears the
+pending runs of running tasks (IsQueued)
 */
 func (r *Repo) ResetIsQueued() {
+	r.DB.Model(&TaskModel{}).Where("status = ?", StatusQueued).Updates(statusColumns(StatusIdle))
 	r.DB.Model(&TaskModel{}).Where("is_queued = ?", true).Update("is_queued", false)
 }
 
 /*
 GetRunnableTask queries the database for all runnableTasks i.e where
-is_queued=False, is_running=False & is_disabled=False
+is_queued=False, is_running=False, is_disabled=False & is_completed=False.
+Running tasks whose concurrency policy permits overlapping runs are included,
+use AcquireRunSlot to decide if a new run may start.
+Tasks outside their active window, inside a blackout period or paused are excluded.
 */
 func (r *Repo) GetRunnableTasks() ([]*TaskModel, error) {
+	now := time.Now()
 	tasks := make([]*TaskModel, 0)
-	if err := r.DB.Model(&TaskModel{}).Where(
-		"is_error = ? AND is_queued = ? AND is_running = ? AND is_disabled = ?", false, false, false, false,
-	).Find(&tasks).Error; err != nil {
+	if err := runnable(r.DB.Model(&TaskModel{})).Find(&tasks).Error; err != nil {
 		return nil, err
 	}
-	return tasks, nil
+	runnable := make([]*TaskModel, 0, len(tasks))
+	for _, task := range tasks {
+		if task.IsActive(now) && !task.IsPausedAt(now) {
+			runnable = append(runnable, task)
+		}
+	}
+	return runnable, nil
 }
 
 /*
@@ -349,9 +396,37 @@ func (r *Repo) VerifyToken(token string) (user *UserModel, err error) {
 	return user, result.Error
 }
 
+/*
+Transition atomically moves the task with the provided taskID from status from to
+status to, returning the updated *TaskModel. It fails with ErrIllegalTransition if
+the move is not allowed and with ErrStatusConflict if the task is not in status from
+e.g because another scheduler moved it first.
+*/
+func (r *Repo) Transition(taskID string, from TaskStatus, to TaskStatus) (*TaskModel, error) {
+	if !from.IsValid() || !from.CanTransition(to) {
+		return nil, fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, from, to)
+	}
+	columns := statusColumns(to)
+	//the status condition is evaluated by the database so concurrent moves cannot both succeed
+	result := r.DB.Model(&TaskModel{}).Where("task_id = ? AND status = ?", taskID, from).Updates(columns)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	task, err := r.GetTaskByID(taskID)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: task %v is %v, not %v", ErrStatusConflict, taskID, task.Status, from)
+	}
+	return task, nil
+}
+
 /*
 SetIsRunning sets task.IsRunning field to value,
-returning an updated *TaskModel and an error
+returning an updated *TaskModel and an error.
+It fails with ErrIllegalTransition if the task cannot start e.g it is disabled.
+Unlike Transition, the task's status is not checked atomically.
 */
 func (r *Repo) SetIsRunning(taskName string, value bool) (*TaskModel, error) {
 	var task TaskModel
@@ -361,10 +436,14 @@ func (r *Repo) SetIsRunning(taskName string, value bool) (*TaskModel, error) {
 		return nil, err
 	}
 
-	if value {
-		task.IsQueued = false
+	if value && task.Status != StatusRunning {
+		if !task.Status.CanTransition(StatusRunning) {
+			return nil, fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, task.Status, StatusRunning)
+		}
+		task.setStatus(StatusRunning)
+	} else if !value && task.Status == StatusRunning {
+		task.setStatus(StatusIdle)
 	}
-	task.IsRunning = value
 	if err := r.DB.Save(&task).Error; err != nil {
 		fmt.Println("Failed to update task: ", err)
 		return nil, err
@@ -374,7 +453,8 @@ func (r *Repo) SetIsRunning(taskName string, value bool) (*TaskModel, error) {
 
 /*
 SetIsError sets task.IsError field to value ,
-returning *TaskModel and an error
+returning *TaskModel and an error.
+It fails with ErrIllegalTransition if the task cannot fail e.g it is disabled.
 */
 func (r *Repo) SetIsError(taskName string, value bool, err string) (*TaskModel, error) {
 	var task TaskModel
@@ -383,12 +463,14 @@ func (r *Repo) SetIsError(taskName string, value bool, err string) (*TaskModel,
 		return nil, err
 	}
 
-	if value {
-		//if true, set isRunning to false
-		task.IsRunning = false
-		task.IsQueued = false
+	if value && task.Status != StatusFailed {
+		if !task.Status.CanTransition(StatusFailed) {
+			return nil, fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, task.Status, StatusFailed)
+		}
+		task.setStatus(StatusFailed)
+	} else if !value && task.Status == StatusFailed {
+		task.setStatus(StatusIdle)
 	}
-	task.IsError = value
 	task.ErrorTxt = err
 	if err := r.DB.Save(&task).Error; err != nil {
 		fmt.Println("Failed to update task: ", err)
@@ -399,7 +481,9 @@ func (r *Repo) SetIsError(taskName string, value bool, err string) (*TaskModel,
 
 /*
 SetIsQueued sets task.IsQueued field to value,
-returning *TaskModel and an error
+returning *TaskModel and an error.
+It fails with ErrIllegalTransition if the task cannot be queued e.g it is disabled.
+A running task stays running with a run waiting, see AcquireRunSlot.
 */
 func (r *Repo) SetIsQueued(taskName string, value bool) (*TaskModel, error) {
 	var task TaskModel
@@ -408,12 +492,18 @@ func (r *Repo) SetIsQueued(taskName string, value bool) (*TaskModel, error) {
 		return nil, err
 	}
 
-	if value {
-		//if true, set isRunning to false
-		task.IsRunning = false
-		task.IsError = false
+	switch {
+	case task.Status == StatusRunning:
+		//a running task may have a run waiting, see AcquireRunSlot
+		task.IsQueued = value
+	case value && task.Status != StatusQueued:
+		if !task.Status.CanTransition(StatusQueued) {
+			return nil, fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, task.Status, StatusQueued)
+		}
+		task.setStatus(StatusQueued)
+	case !value && task.Status == StatusQueued:
+		task.setStatus(StatusIdle)
 	}
-	task.IsQueued = value
 	if err := r.DB.Save(&task).Error; err != nil {
 		fmt.Println("Failed to update task: ", err)
 		return nil, err
@@ -433,12 +523,10 @@ func (r *Repo) SetIsDisabled(taskName string, value bool) (*TaskModel, error) {
 	}
 
 	if value {
-		//if true, set all other statusFields to false
-		task.IsRunning = false
-		task.IsError = false
-		task.IsQueued = false
+		task.setStatus(StatusDisabled)
+	} else if task.Status == StatusDisabled {
+		task.setStatus(StatusIdle)
 	}
-	task.IsDisabled = value
 	if err := r.DB.Save(&task).Error; err != nil {
 		fmt.Println("Failed to update task: ", err)
 		return nil, err
@@ -446,8 +534,116 @@ func (r *Repo) SetIsDisabled(taskName string, value bool) (*TaskModel, error) {
 	return &task, nil
 }
 
-/*DeleteTask attempts to delete the provided task from the database and returns an error*/
+/*
+SetIsCompleted marks a task as completed e.g after a Once task has run,
+returning *TaskModel and an error.
+It fails with ErrIllegalTransition if the task cannot complete e.g it is disabled.
+*/
+func (r *Repo) SetIsCompleted(taskName string) (*TaskModel, error) {
+	var task TaskModel
+	//Find the task by taskName
+	if err := r.DB.Where("name = ?", taskName).First(&task).Error; err != nil {
+		return nil, err
+	}
+
+	if task.Status != StatusCompleted && !task.Status.CanTransition(StatusCompleted) {
+		return nil, fmt.Errorf("%w: %v -> %v", ErrIllegalTransition, task.Status, StatusCompleted)
+	}
+	//a completed task is neither running, queued nor failed
+	task.setStatus(StatusCompleted)
+	if err := r.DB.Save(&task).Error; err != nil {
+		fmt.Println("Failed to update task: ", err)
+		return nil, err
+	}
+	return &task, nil
+}
+
+/*
+AcquireRunSlot atomically decides, according to the task's concurrency policy,
+whether a run that is due may start. When the run may start (RunStart or RunReplace)
+the task's running count is incremented and ReleaseRunSlot must be called once
+the run finishes. RunQueue marks the task as queued.
+*/
+func (r *Repo) AcquireRunSlot(taskID string) (RunDecision, error) {
+	task, err := r.GetTaskByID(taskID)
+	if err != nil {
+		return "", err
+	}
+	start := map[string]interface{}{
+		"running_count": gorm.Expr("running_count + 1"),
+		"status":        StatusRunning,
+		"is_running":    true,
+		"is_queued":     false,
+		"is_error":      false,
+	}
+	//disabled & completed tasks cannot move to running, nor can paused ones
+	unstartable := []string{string(StatusDisabled), string(StatusCompleted)}
+	now := time.Now()
+	query := unpaused(r.DB.Model(&TaskModel{}), now).Where("task_id = ? AND status NOT IN ?", taskID, unstartable)
+	if limit := task.RunLimit(); limit > 0 {
+		//the condition is evaluated by the database so concurrent callers cannot exceed limit
+		query = query.Where("running_count < ?", limit)
+	}
+	result := query.Updates(start)
+	if result.Error != nil {
+		return "", result.Error
+	}
+	if result.RowsAffected == 1 {
+		return RunStart, nil
+	}
+	switch task.ConcurrencyPolicy {
+	case dto.ConcurrencyReplace:
+		result := unpaused(r.DB.Model(&TaskModel{}), now).Where("task_id = ? AND status NOT IN ?", taskID, unstartable).Updates(start)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected == 1 {
+			return RunReplace, nil
+		}
+	case dto.ConcurrencyQueue:
+		result := unpaused(r.DB.Model(&TaskModel{}), now).Where("task_id = ? AND status NOT IN ?", taskID, unstartable).Update("is_queued", true)
+		if result.Error != nil {
+			return "", result.Error
+		}
+		if result.RowsAffected == 1 {
+			return RunQueue, nil
+		}
+	}
+	return RunSkip, nil
+}
+
+/*
+ReleaseRunSlot records that a run started through AcquireRunSlot has finished,
+returning the updated *TaskModel. A task with IsQueued set has a run waiting to start.
+Once the last run finishes a task that is still running becomes idle, or completed for a
+OnceTask, record the outcome with Transition(taskID, StatusRunning, StatusSucceeded or
+StatusFailed) before releasing to keep it instead. Only ReleaseRunSlot frees a slot, call it for every run that was
+started through AcquireRunSlot, including runs stopped when a task is disabled.
+*/
+func (r *Repo) ReleaseRunSlot(taskID string) (*TaskModel, error) {
+	//the last run of a running task, every column is evaluated against the values before the update
+	last := "running_count <= 1 AND status = ?"
+	err := r.DB.Model(&TaskModel{}).Where("task_id = ?", taskID).Updates(map[string]interface{}{
+		"running_count":       gorm.Expr("CASE WHEN running_count > 0 THEN running_count - 1 ELSE 0 END"),
+		"is_running":          gorm.Expr("running_count > 1 AND status = ?", StatusRunning),
+		"status":              gorm.Expr("CASE WHEN NOT ("+last+") THEN status WHEN type = ? THEN ? ELSE ? END", StatusRunning, OnceTask, StatusCompleted, StatusIdle),
+		"is_completed":        gorm.Expr("is_completed OR ("+last+" AND type = ?)", StatusRunning, OnceTask),
+		"next_execution_time": gorm.Expr("CASE WHEN "+last+" AND type = ? THEN NULL ELSE next_execution_time END", StatusRunning, OnceTask),
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	return r.GetTaskByID(taskID)
+}
+
+/*DeleteTask attempts to delete the provided task, its dependencies and subscriptions from the database and returns an error*/
 func (r *Repo) DeleteTask(task *TaskModel) error {
+	if err := r.DB.Unscoped().Where("task_name = ?", task.Name).Delete(&TaskDependencyModel{}).Error; err != nil {
+		return err
+	}
+	if err := r.DB.Unscoped().Where("task_name = ?", task.Name).Delete(&EventSubscriptionModel{}).Error; err != nil {
+		return err
+	}
 	return r.DB.Delete(&task, task.ID).Error
 }
 
@@ -463,3 +659,576 @@ func (r *Repo) UpdateExecutionTime(task *TaskModel, t *time.Time, sub *time.Time
 	task.NextExecutionTime = t
 	return r.SaveTask(task)
 }
+
+/*
+SaveCalendar creates the provided calendar or, if a calendar
+with the same name already exists, replaces its dates
+*/
+func (r *Repo) SaveCalendar(calendar *CalendarModel) error {
+	var existing CalendarModel
+	err := r.DB.Where("name = ?", calendar.Name).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return r.DB.Create(calendar).Error
+	}
+	if err != nil {
+		return err
+	}
+	existing.Dates = calendar.Dates
+	existing.Source = calendar.Source
+	if err := r.DB.Save(&existing).Error; err != nil {
+		r.logger.Error("error updating calendar %v: %v", calendar.Name, err)
+		return err
+	}
+	*calendar = existing
+	return nil
+}
+
+/*GetCalendarByName queries the database for a calendar where calendar.Name = name*/
+func (r *Repo) GetCalendarByName(name string) (*CalendarModel, error) {
+	var calendar CalendarModel
+	if err := r.DB.First(&calendar, "name = ?", name).Error; err != nil {
+		return nil, err
+	}
+	return &calendar, nil
+}
+
+/*GetCalendars returns the calendars with the provided names as *dto.Calendar, failing if any of them is missing*/
+func (r *Repo) GetCalendars(names ...string) ([]*dto.Calendar, error) {
+	calendars := make([]*dto.Calendar, 0, len(names))
+	for _, name := range names {
+		model, err := r.GetCalendarByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("calendar %v: %w", name, err)
+		}
+		calendar, err := model.Calendar()
+		if err != nil {
+			return nil, err
+		}
+		calendars = append(calendars, calendar)
+	}
+	return calendars, nil
+}
+
+/*GetAllCalendars returns all calendars stored in the database*/
+func (r *Repo) GetAllCalendars() ([]*CalendarModel, error) {
+	calendars := make([]*CalendarModel, 0)
+	if err := r.DB.Find(&calendars).Error; err != nil {
+		return nil, err
+	}
+	return calendars, nil
+}
+
+/*DeleteCalendar deletes the calendar with the provided name*/
+func (r *Repo) DeleteCalendar(name string) error {
+	//hard delete so the name can be reused
+	return r.DB.Unscoped().Where("name = ?", name).Delete(&CalendarModel{}).Error
+}
+
+/*
+StartTaskRun records the start of a run of the task with the provided taskID and
+returns it. attempt starts at 1 and logOffset is the current size of the task's log.
+*/
+func (r *Repo) StartTaskRun(taskID string, trigger RunTrigger, attempt int, logOffset int64) (*TaskRunModel, error) {
+	run := &TaskRunModel{
+		RunId:     uuid.New().String(),
+		TaskId:    taskID,
+		Trigger:   trigger,
+		Attempt:   attempt,
+		StartedAt: time.Now(),
+		LogOffset: logOffset,
+	}
+	if err := r.DB.Create(run).Error; err != nil {
+		r.logger.Error("error recording start of run for task %v: %v", taskID, err)
+		return nil, err
+	}
+	return run, nil
+}
+
+/*
+FinishTaskRun records the end of the run with the provided runID, its exit code
+and error text (empty if the run succeeded). errTxt is what the task's process wrote
+to stderr, including the stack of a panic, see tasks.ErrorText. A failed run's errTxt
+is also stored as the task's ErrorTxt.
+*/
+func (r *Repo) FinishTaskRun(runID string, exitCode int, errTxt string) (*TaskRunModel, error) {
+	run, err := r.GetTaskRun(runID)
+	if err != nil {
+		return nil, err
+	}
+	if run.IsFinished() {
+		return nil, fmt.Errorf("run %v already finished", runID)
+	}
+	endedAt := time.Now()
+	run.EndedAt = &endedAt
+	run.Duration = endedAt.Sub(run.StartedAt)
+	run.ExitCode = &exitCode
+	run.ErrorTxt = errTxt
+	err = r.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(run).Error; err != nil {
+			return err
+		}
+		if exitCode == 0 {
+			return nil
+		}
+		return tx.Model(&TaskModel{}).Where("task_id = ?", run.TaskId).Update("error_txt", errTxt).Error
+	})
+	if err != nil {
+		r.logger.Error("error recording end of run %v: %v", runID, err)
+		return nil, err
+	}
+	return run, nil
+}
+
+/*GetTaskRun queries the database for a run where run.RunId = runID*/
+func (r *Repo) GetTaskRun(runID string) (*TaskRunModel, error) {
+	var run TaskRunModel
+	if err := r.DB.First(&run, "run_id = ?", runID).Error; err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+/*
+GetTaskRuns returns a page of the runs of the task with the provided taskID, most
+recent first, along with the total number of runs of the task. offset is the number
+of runs to skip and limit the page size.
+*/
+func (r *Repo) GetTaskRuns(taskID string, offset int, limit int) ([]*TaskRunModel, int64, error) {
+	if offset < 0 || limit <= 0 {
+		return nil, 0, fmt.Errorf("invalid page offset %d limit %d", offset, limit)
+	}
+	var total int64
+	query := r.DB.Model(&TaskRunModel{}).Where("task_id = ?", taskID)
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	runs := make([]*TaskRunModel, 0, limit)
+	if err := query.Order("started_at DESC").Order("id DESC").Offset(offset).Limit(limit).Find(&runs).Error; err != nil {
+		return nil, 0, err
+	}
+	return runs, total, nil
+}
+
+/*
+PruneTaskRuns deletes the finished runs started before the provided time, returning
+the number of runs deleted. Runs still in progress are kept so they can be finished.
+*/
+func (r *Repo) PruneTaskRuns(before time.Time) (int64, error) {
+	//hard delete, run history is only ever pruned to reclaim space
+	result := r.DB.Unscoped().Where("started_at < ? AND ended_at IS NOT NULL", before).Delete(&TaskRunModel{})
+	return result.RowsAffected, result.Error
+}
+
+/*
+runnable restricts query to tasks that may start a run, see GetRunnableTasks
+*/
+func runnable(query *gorm.DB) *gorm.DB {
+	overlapping := []string{string(dto.ConcurrencyAllow), string(dto.ConcurrencyReplace), string(dto.ConcurrencyQueue)}
+	return query.Where(
+		"is_error = ? AND is_queued = ? AND is_disabled = ? AND is_completed = ?", false, false, false, false,
+	).Where(
+		"is_running = ? OR concurrency_policy IN ?", false, overlapping,
+	)
+}
+
+/*
+unpaused restricts query to tasks whose schedule is not paused at now, see TaskModel.IsPausedAt
+*/
+func unpaused(query *gorm.DB, now time.Time) *gorm.DB {
+	//pause times are always written in UTC so they compare correctly on sqlite
+	return query.Where("is_paused = ? OR (paused_until IS NOT NULL AND paused_until <= ?)", false, now.UTC())
+}
+
+/*
+unleased restricts query to tasks without an unexpired lease at now
+*/
+func unleased(query *gorm.DB, now time.Time) *gorm.DB {
+	//lease expiries are always written in UTC so they compare correctly on sqlite
+	return query.Where("lease_owner = ? OR lease_owner IS NULL OR lease_expires_at IS NULL OR lease_expires_at <= ?", "", now.UTC())
+}
+
+/*
+ClaimDueTasks leases up to limit runnable tasks that are due at now to the scheduler
+instance workerID, returning them with their lease expiry. A leased task is not
+claimed by other instances until its lease expires or is released, so several
+schedulers can share a database. Renew the lease of long running tasks with
+RenewLease and release it with ReleaseLease once the task has been handled.
+
+On sqlite execution times are stored as text with the offset they were written
+in, so they cannot be compared in SQL and a single `UPDATE ... WHERE id IN
+(SELECT ... LIMIT ?)` could claim tasks that are not due. The due tasks are
+instead picked in Go and each is claimed with a conditional UPDATE that
+re-checks the row, see below. Postgres claims in SQL, see claimLocked.
+*/
+func (r *Repo) ClaimDueTasks(workerID string, now time.Time, limit int) ([]*TaskModel, error) {
+	if workerID == "" {
+		return nil, fmt.Errorf("workerID is required to claim tasks")
+	}
+	if limit <= 0 {
+		return nil, fmt.Errorf("invalid claim limit %d", limit)
+	}
+	expiresAt := now.UTC().Add(LeaseDuration).Truncate(time.Microsecond)
+	lease := map[string]interface{}{
+		"lease_owner":      workerID,
+		"lease_expires_at": expiresAt,
+	}
+	if r.DB.Dialector.Name() == string(Postgres) {
+		return r.claimLocked(workerID, now, limit, lease)
+	}
+	var candidates []*TaskModel
+	if err := unpaused(unleased(runnable(r.DB.Model(&TaskModel{})), now), now).Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+	claimed := make([]*TaskModel, 0, limit)
+	for _, task := range dueTasks(candidates, now) {
+		if len(claimed) == limit {
+			break
+		}
+		//the update re-checks that the task is still runnable, unleased, unpaused & due at the
+		//execution time that was read, so a task claimed or rescheduled by another instance
+		//since it was read is not claimed again
+		result := unleased(runnable(r.DB.Model(&TaskModel{})), now).
+			Where("id = ? AND next_execution_time = ? AND is_paused = ?", task.ID, *task.NextExecutionTime, task.IsPaused).
+			Updates(lease)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+		task.LeaseOwner = workerID
+		task.LeaseExpiresAt = &expiresAt
+		claimed = append(claimed, task)
+	}
+	if len(claimed) == 0 {
+		return nil, nil
+	}
+	return claimed, nil
+}
+
+/*
+claimLocked claims due tasks on postgres, locking limit candidate rows at a time with
+SELECT ... FOR UPDATE SKIP LOCKED so concurrent claims skip each other's rows. Candidates
+outside their active window or in a blackout are skipped & the next rows are locked.
+*/
+func (r *Repo) claimLocked(workerID string, now time.Time, limit int, lease map[string]interface{}) ([]*TaskModel, error) {
+	var claimed []*TaskModel
+	err := r.DB.Transaction(func(tx *gorm.DB) error {
+		query := unpaused(unleased(runnable(tx.Model(&TaskModel{})), now), now).
+			Where("next_execution_time <= ?", now).
+			Order("next_execution_time").
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Session(&gorm.Session{})
+		ids := make([]uint, 0, limit)
+		for offset := 0; len(ids) < limit; offset += limit {
+			var candidates []*TaskModel
+			if err := query.Offset(offset).Limit(limit).Find(&candidates).Error; err != nil {
+				return err
+			}
+			for _, task := range dueTasks(candidates, now) {
+				if len(ids) < limit {
+					ids = append(ids, task.ID)
+				}
+			}
+			if len(candidates) < limit {
+				break
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		if err := tx.Model(&TaskModel{}).Where("id IN ?", ids).Updates(lease).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Order("next_execution_time").Find(&claimed).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return claimed, nil
+}
+
+/*
+dueTasks returns the candidates that are due and active at now, earliest first
+*/
+func dueTasks(candidates []*TaskModel, now time.Time) []*TaskModel {
+	due := make([]*TaskModel, 0, len(candidates))
+	for _, task := range candidates {
+		if task.NextExecutionTime != nil && !task.NextExecutionTime.After(now) && task.IsActive(now) && !task.IsPausedAt(now) {
+			due = append(due, task)
+		}
+	}
+	sortByNextExecution(due)
+	return due
+}
+
+// sortByNextExecution sorts tasks by NextExecutionTime, tasks without one last
+func sortByNextExecution(tasks []*TaskModel) {
+	//sorted in Go as sqlite compares times with different offsets as strings
+	sort.SliceStable(tasks, func(i, j int) bool {
+		if tasks[j].NextExecutionTime == nil {
+			return tasks[i].NextExecutionTime != nil
+		}
+		return tasks[i].NextExecutionTime != nil && tasks[i].NextExecutionTime.Before(*tasks[j].NextExecutionTime)
+	})
+}
+
+/*
+RenewLease extends workerID's lease on the task with the provided taskID to
+LeaseDuration from now, returning the new expiry. It fails with ErrLeaseLost
+if the lease expired and the task was claimed by another instance.
+*/
+func (r *Repo) RenewLease(taskID string, workerID string, now time.Time) (time.Time, error) {
+	expiresAt := now.UTC().Add(LeaseDuration).Truncate(time.Microsecond)
+	result := r.DB.Model(&TaskModel{}).Where("task_id = ? AND lease_owner = ?", taskID, workerID).
+		Update("lease_expires_at", expiresAt)
+	if result.Error != nil {
+		return time.Time{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return time.Time{}, fmt.Errorf("%w: task %v is not leased to %v", ErrLeaseLost, taskID, workerID)
+	}
+	return expiresAt, nil
+}
+
+/*
+ReleaseLease gives up workerID's lease on the task with the provided taskID so
+other instances may claim it once it is due again. It fails with ErrLeaseLost
+if the task is no longer leased to workerID.
+*/
+func (r *Repo) ReleaseLease(taskID string, workerID string) error {
+	result := r.DB.Model(&TaskModel{}).Where("task_id = ? AND lease_owner = ?", taskID, workerID).
+		Updates(map[string]interface{}{
+			"lease_owner":      "",
+			"lease_expires_at": nil,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: task %v is not leased to %v", ErrLeaseLost, taskID, workerID)
+	}
+	return nil
+}
+
+/*
+SetDependencies replaces the upstream tasks of the task called taskName, which
+runs after them according to condition. No upstream tasks removes its dependencies.
+Upstream tasks do not need to exist yet. The dependencies are not saved if they
+would form a cycle, a *dag.CycleError is returned instead.
+*/
+func (r *Repo) SetDependencies(taskName string, upstream []string, condition dto.DependencyCondition) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		var others []*TaskDependencyModel
+		if err := tx.Where("task_name <> ?", taskName).Find(&others).Error; err != nil {
+			return err
+		}
+		deps := make([]dto.Dependency, 0, len(others)+len(upstream))
+		for _, other := range others {
+			deps = append(deps, other.Dependency())
+		}
+		models := make([]*TaskDependencyModel, 0, len(upstream))
+		for _, name := range upstream {
+			model := &TaskDependencyModel{TaskName: taskName, UpstreamName: name, Condition: condition}
+			deps = append(deps, model.Dependency())
+			models = append(models, model)
+		}
+		if err := dag.FindCycle(deps); err != nil {
+			return err
+		}
+		//hard delete so the unique index allows re-adding an edge
+		if err := tx.Unscoped().Where("task_name = ?", taskName).Delete(&TaskDependencyModel{}).Error; err != nil {
+			return err
+		}
+		if len(models) == 0 {
+			return nil
+		}
+		return tx.Create(&models).Error
+	})
+}
+
+/*GetDependencies returns the upstream dependencies of the task called taskName*/
+func (r *Repo) GetDependencies(taskName string) ([]*TaskDependencyModel, error) {
+	deps := make([]*TaskDependencyModel, 0)
+	if err := r.DB.Where("task_name = ?", taskName).Order("upstream_name").Find(&deps).Error; err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+/*GetDependents returns the dependencies of the tasks that run after the task called upstreamName*/
+func (r *Repo) GetDependents(upstreamName string) ([]*TaskDependencyModel, error) {
+	deps := make([]*TaskDependencyModel, 0)
+	if err := r.DB.Where("upstream_name = ?", upstreamName).Order("task_name").Find(&deps).Error; err != nil {
+		return nil, err
+	}
+	return deps, nil
+}
+
+/*GetAllDependencies returns every dependency stored in the database*/
+func (r *Repo) GetAllDependencies() ([]dto.Dependency, error) {
+	models := make([]*TaskDependencyModel, 0)
+	if err := r.DB.Find(&models).Error; err != nil {
+		return nil, err
+	}
+	deps := make([]dto.Dependency, 0, len(models))
+	for _, model := range models {
+		deps = append(deps, model.Dependency())
+	}
+	return deps, nil
+}
+
+/*
+DownstreamRunnable returns the tasks that may run now that a run of the task called
+upstreamName finished, succeeded being its outcome, see dag.Downstream. Record the
+upstream run with FinishTaskRun first. Paused, disabled & completed tasks are left out.
+*/
+func (r *Repo) DownstreamRunnable(upstreamName string, succeeded bool) ([]*TaskModel, error) {
+	deps, err := r.GetAllDependencies()
+	if err != nil {
+		return nil, err
+	}
+	//latest runs are only needed for the dependents of upstreamName & their upstream tasks
+	involved := make(map[string]bool)
+	for _, dep := range deps {
+		if dep.Upstream == upstreamName {
+			involved[dep.Task] = true
+		}
+	}
+	for _, dep := range deps {
+		if involved[dep.Task] {
+			involved[dep.Upstream] = true
+		}
+	}
+	tasks := make(map[string]*TaskModel, len(involved))
+	latest := make(map[string]dag.Run, len(involved))
+	for name := range involved {
+		task, err := r.GetTaskByName(name)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tasks[name] = task
+		var run TaskRunModel
+		err = r.DB.Where("task_id = ? AND ended_at IS NOT NULL", task.TaskId).Order("started_at DESC").First(&run).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		latest[name] = dag.Run{Succeeded: run.Succeeded(), StartedAt: run.StartedAt, EndedAt: *run.EndedAt}
+	}
+	runnable := make([]*TaskModel, 0)
+	now := time.Now()
+	for _, name := range dag.Downstream(deps, upstreamName, succeeded, latest) {
+		if task, ok := tasks[name]; ok && !task.IsDisabled && !task.IsCompleted && !task.IsPausedAt(now) {
+			runnable = append(runnable, task)
+		}
+	}
+	return runnable, nil
+}
+
+/*
+SetSubscriptions replaces the events the task called taskName is subscribed to,
+no events removes its subscriptions
+*/
+func (r *Repo) SetSubscriptions(taskName string, events ...string) error {
+	return r.DB.Transaction(func(tx *gorm.DB) error {
+		//hard delete so the unique index allows re-subscribing
+		if err := tx.Unscoped().Where("task_name = ?", taskName).Delete(&EventSubscriptionModel{}).Error; err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			return nil
+		}
+		subscriptions := make([]*EventSubscriptionModel, 0, len(events))
+		for _, event := range events {
+			subscriptions = append(subscriptions, &EventSubscriptionModel{Event: event, TaskName: taskName})
+		}
+		return tx.Create(&subscriptions).Error
+	})
+}
+
+/*GetSubscriptions returns the events the task called taskName is subscribed to*/
+func (r *Repo) GetSubscriptions(taskName string) ([]string, error) {
+	events := make([]string, 0)
+	if err := r.DB.Model(&EventSubscriptionModel{}).Where("task_name = ?", taskName).Order("event").Pluck("event", &events).Error; err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+/*
+GetSubscribers returns the tasks subscribed to the event called event, i.e the tasks
+to run when it is published. Paused, disabled & completed tasks are left out.
+*/
+func (r *Repo) GetSubscribers(event string) ([]*TaskModel, error) {
+	tasks := make([]*TaskModel, 0)
+	subscribed := r.DB.Model(&EventSubscriptionModel{}).Select("task_name").Where("event = ?", event)
+	query := unpaused(r.DB, time.Now()).Where("is_disabled = ? AND is_completed = ?", false, false)
+	if err := query.Where("name IN (?)", subscribed).Order("name").Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+/*
+PauseTask suspends the schedule of the task with the provided taskID until the
+provided time, or until ResumeTask is called if until is nil. Runs that fall inside
+the pause are skipped rather than handled by the task's misfire policy: resuming sets
+ResumedAt, see TaskModel.MisfireBaseline. Paused tasks are not claimed, started or
+triggered by events, upstream tasks or file changes.
+*/
+func (r *Repo) PauseTask(taskID string, until *time.Time) (*TaskModel, error) {
+	var pausedUntil *time.Time
+	if until != nil {
+		//written in UTC so it compares correctly on sqlite, see ResumeExpiredPauses
+		utc := until.UTC()
+		pausedUntil = &utc
+	}
+	result := r.DB.Model(&TaskModel{}).Where("task_id = ?", taskID).Updates(map[string]interface{}{
+		"is_paused":    true,
+		"paused_until": pausedUntil,
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return r.GetTaskByID(taskID)
+}
+
+/*
+ResumeTask resumes the schedule of the task with the provided taskID, see PauseTask
+*/
+func (r *Repo) ResumeTask(taskID string) (*TaskModel, error) {
+	result := r.DB.Model(&TaskModel{}).Where("task_id = ? AND is_paused = ?", taskID, true).Updates(map[string]interface{}{
+		"is_paused":    false,
+		"paused_until": nil,
+		"resumed_at":   time.Now().UTC(),
+	})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	//a task that is not paused is left as is, GetTaskByID fails if it does not exist
+	return r.GetTaskByID(taskID)
+}
+
+/*
+ResumeExpiredPauses resumes the tasks paused until a time at or before now,
+returning the number of tasks resumed
+*/
+func (r *Repo) ResumeExpiredPauses(now time.Time) (int64, error) {
+	result := r.DB.Model(&TaskModel{}).Where(
+		"is_paused = ? AND paused_until IS NOT NULL AND paused_until <= ?", true, now.UTC(),
+	).Updates(map[string]interface{}{
+		"is_paused":    false,
+		"resumed_at":   gorm.Expr("paused_until"),
+		"paused_until": nil,
+	})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,622 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+	"github.com/aodr3w/keiji-core/logging"
+)
+
+// newTestRepo returns a Repo backed by a sqlite database in a temporary directory
+func newTestRepo(t *testing.T) *Repo {
+	t.Helper()
+	dir := t.TempDir()
+	backend := DatabaseBackend{DBType: SQLite, DBURL: filepath.Join(dir, "keiji.db")}
+	if err := backend.AutoMigrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	gormDB, err := backend.Connect()
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	logger, err := logging.NewFileLogger(filepath.Join(dir, "repo.log"))
+	if err != nil {
+		t.Fatalf("logger: %v", err)
+	}
+	repo := &Repo{gormDB, logger, sync.Mutex{}}
+	t.Cleanup(repo.Close)
+	return repo
+}
+
+// newTestTask saves an idle HMS task named name that is due at next
+func newTestTask(t *testing.T, repo *Repo, name string, next time.Time) *TaskModel {
+	t.Helper()
+	task := &TaskModel{
+		TaskId:            name + "-id",
+		Name:              name,
+		Slug:              name,
+		Type:              HMSTask,
+		ScheduleInfo:      dto.ScheduleSpec{Version: dto.ScheduleSpecVersion, Type: string(HMSTask), Interval: 1, Units: "seconds"},
+		NextExecutionTime: &next,
+		Status:            StatusIdle,
+	}
+	if err := repo.DB.Create(task).Error; err != nil {
+		t.Fatalf("create %v: %v", name, err)
+	}
+	return task
+}
+
+// getTask returns the stored task called name
+func getTask(t *testing.T, repo *Repo, name string) *TaskModel {
+	t.Helper()
+	task, err := repo.GetTaskByName(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return task
+}
+
+func TestTransition(t *testing.T) {
+	repo := newTestRepo(t)
+	newTestTask(t, repo, "job", time.Now())
+	task, err := repo.Transition("job-id", StatusIdle, StatusRunning)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusRunning || !task.IsRunning || task.IsQueued {
+		t.Fatalf("task = %v running %t queued %t, want running", task.Status, task.IsRunning, task.IsQueued)
+	}
+	if _, err := repo.Transition("job-id", StatusIdle, StatusQueued); !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("moving a running task from idle = %v, want ErrStatusConflict", err)
+	}
+	if _, err := repo.Transition("job-id", StatusDisabled, StatusRunning); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("disabled -> running = %v, want ErrIllegalTransition", err)
+	}
+	task, err = repo.Transition("job-id", StatusRunning, StatusFailed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusFailed || !task.IsError || task.IsRunning {
+		t.Fatalf("task = %v error %t running %t, want failed", task.Status, task.IsError, task.IsRunning)
+	}
+}
+
+func TestRunSlots(t *testing.T) {
+	repo := newTestRepo(t)
+	task := newTestTask(t, repo, "job", time.Now())
+	task.ConcurrencyPolicy = dto.ConcurrencyAllow
+	task.MaxConcurrent = 2
+	if err := repo.DB.Save(task).Error; err != nil {
+		t.Fatal(err)
+	}
+	acquire := func(want RunDecision) {
+		t.Helper()
+		decision, err := repo.AcquireRunSlot("job-id")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decision != want {
+			t.Fatalf("AcquireRunSlot = %v, want %v", decision, want)
+		}
+	}
+	expect := func(status TaskStatus, running int) {
+		t.Helper()
+		task := getTask(t, repo, "job")
+		if task.Status != status || task.RunningCount != running {
+			t.Fatalf("task is %v with %d running, want %v with %d", task.Status, task.RunningCount, status, running)
+		}
+	}
+	acquire(RunStart)
+	acquire(RunStart)
+	acquire(RunSkip)
+	expect(StatusRunning, 2)
+	//recording an outcome keeps the slots of runs that have not finished
+	if _, err := repo.Transition("job-id", StatusRunning, StatusFailed); err != nil {
+		t.Fatal(err)
+	}
+	expect(StatusFailed, 2)
+	acquire(RunSkip)
+	if _, err := repo.ReleaseRunSlot("job-id"); err != nil {
+		t.Fatal(err)
+	}
+	expect(StatusFailed, 1)
+	acquire(RunStart)
+	expect(StatusRunning, 2)
+	for i := 0; i < 2; i++ {
+		if _, err := repo.ReleaseRunSlot("job-id"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect(StatusIdle, 0)
+}
+
+func TestReleaseRunSlotCompletesOnceTasks(t *testing.T) {
+	repo := newTestRepo(t)
+	task := newTestTask(t, repo, "job", time.Now())
+	task.Type = OnceTask
+	task.ConcurrencyPolicy = dto.ConcurrencyAllow
+	task.MaxConcurrent = 2
+	if err := repo.DB.Save(task).Error; err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := repo.AcquireRunSlot("job-id"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	task, err := repo.ReleaseRunSlot("job-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusRunning || task.IsCompleted || task.NextExecutionTime == nil {
+		t.Fatalf("task is %v with completed %v, want running until its last run finishes", task.Status, task.IsCompleted)
+	}
+	task, err = repo.ReleaseRunSlot("job-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusCompleted || !task.IsCompleted || task.IsRunning || task.NextExecutionTime != nil {
+		t.Fatalf("task is %v with completed %v and next run %v, want completed", task.Status, task.IsCompleted, task.NextExecutionTime)
+	}
+}
+
+func TestSettersKeepRunningCount(t *testing.T) {
+	repo := newTestRepo(t)
+	newTestTask(t, repo, "job", time.Now())
+	if _, err := repo.AcquireRunSlot("job-id"); err != nil {
+		t.Fatal(err)
+	}
+	task, err := repo.SetIsError("job", true, "boom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusFailed || task.RunningCount != 1 {
+		t.Fatalf("task is %v with %d running, want failed with 1", task.Status, task.RunningCount)
+	}
+	task, err = repo.ReleaseRunSlot("job-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != StatusFailed || task.RunningCount != 0 {
+		t.Fatalf("task is %v with %d running, want failed with 0", task.Status, task.RunningCount)
+	}
+}
+
+func TestSettersCheckTransitions(t *testing.T) {
+	repo := newTestRepo(t)
+	newTestTask(t, repo, "job", time.Now())
+	if _, err := repo.SetIsDisabled("job", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsRunning("job", true); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("SetIsRunning on a disabled task = %v, want ErrIllegalTransition", err)
+	}
+	if _, err := repo.SetIsQueued("job", true); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("SetIsQueued on a disabled task = %v, want ErrIllegalTransition", err)
+	}
+	if _, err := repo.SetIsError("job", true, "boom"); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("SetIsError on a disabled task = %v, want ErrIllegalTransition", err)
+	}
+	if _, err := repo.SetIsCompleted("job"); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("SetIsCompleted on a disabled task = %v, want ErrIllegalTransition", err)
+	}
+	if task := getTask(t, repo, "job"); task.Status != StatusDisabled {
+		t.Fatalf("task is %v, want disabled", task.Status)
+	}
+
+	newTestTask(t, repo, "queued", time.Now())
+	if _, err := repo.SetIsQueued("queued", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsCompleted("queued"); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("SetIsCompleted on a queued task = %v, want ErrIllegalTransition", err)
+	}
+
+	//a Once task that failed is still done
+	newTestTask(t, repo, "once", time.Now())
+	if _, err := repo.Transition("once-id", StatusIdle, StatusRunning); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsError("once", true, "boom"); err != nil {
+		t.Fatal(err)
+	}
+	if task, err := repo.SetIsCompleted("once"); err != nil || task.Status != StatusCompleted {
+		t.Fatalf("SetIsCompleted on a failed task = %v, want completed", err)
+	}
+	if _, err := repo.SetIsError("once", true, "boom"); !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("SetIsError on a completed task = %v, want ErrIllegalTransition", err)
+	}
+}
+
+func TestResetIsQueued(t *testing.T) {
+	repo := newTestRepo(t)
+	newTestTask(t, repo, "queued", time.Now())
+	newTestTask(t, repo, "running", time.Now())
+	if _, err := repo.SetIsQueued("queued", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Transition("running-id", StatusIdle, StatusRunning); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsQueued("running", true); err != nil {
+		t.Fatal(err)
+	}
+	repo.ResetIsQueued()
+	if task := getTask(t, repo, "queued"); task.Status != StatusIdle || task.IsQueued {
+		t.Errorf("queued task is %v queued %t, want idle", task.Status, task.IsQueued)
+	}
+	if task := getTask(t, repo, "running"); task.Status != StatusRunning || task.IsQueued {
+		t.Errorf("running task is %v queued %t, want running without a run waiting", task.Status, task.IsQueued)
+	}
+}
+
+func TestSaveTaskReschedulesCompleted(t *testing.T) {
+	repo := newTestRepo(t)
+	task := newTestTask(t, repo, "job", time.Now())
+	if _, err := repo.SetIsCompleted("job"); err != nil {
+		t.Fatal(err)
+	}
+	same := *task
+	same.ID = 0
+	if err := repo.SaveTask(&same); err != nil {
+		t.Fatal(err)
+	}
+	if task := getTask(t, repo, "job"); task.Status != StatusCompleted {
+		t.Fatalf("saving the same schedule moved the task to %v", task.Status)
+	}
+	changed := same
+	changed.ScheduleInfo.Interval = 2
+	if err := repo.SaveTask(&changed); err != nil {
+		t.Fatal(err)
+	}
+	if task := getTask(t, repo, "job"); task.Status != StatusIdle || task.IsCompleted {
+		t.Fatalf("task given a new schedule is %v, want idle", task.Status)
+	}
+}
+
+func TestGetRunnableTasksWindow(t *testing.T) {
+	repo := newTestRepo(t)
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	window := func(name string, spec func(*dto.ScheduleSpec)) {
+		task := newTestTask(t, repo, name, now)
+		spec(&task.ScheduleInfo)
+		if err := repo.SaveTask(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	window("open", func(s *dto.ScheduleSpec) {})
+	window("inside", func(s *dto.ScheduleSpec) { s.StartAt, s.EndAt = &earlier, &later })
+	window("not started", func(s *dto.ScheduleSpec) { s.StartAt = &later })
+	window("ended", func(s *dto.ScheduleSpec) { s.EndAt = &earlier })
+	window("blacked out", func(s *dto.ScheduleSpec) { s.Blackouts = []dto.TimeRange{{Start: earlier, End: later}} })
+	tasks, err := repo.GetRunnableTasks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, task := range tasks {
+		names = append(names, task.Name)
+	}
+	if fmt.Sprint(names) != "[open inside]" {
+		t.Fatalf("GetRunnableTasks = %v, want [open inside]", names)
+	}
+}
+
+func TestClaimDueTasks(t *testing.T) {
+	repo := newTestRepo(t)
+	nairobi := time.FixedZone("EAT", 3*60*60)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	newTestTask(t, repo, "due-utc", now.Add(-time.Minute))
+	newTestTask(t, repo, "due-offset", now.Add(-2*time.Minute).In(nairobi))
+	newTestTask(t, repo, "later", now.Add(time.Hour).In(nairobi))
+
+	claimed, err := repo.ClaimDueTasks("a", now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, task := range claimed {
+		names = append(names, task.Name)
+		if task.LeaseOwner != "a" {
+			t.Errorf("%v lease owner = %q, want a", task.Name, task.LeaseOwner)
+		}
+	}
+	if fmt.Sprint(names) != "[due-offset due-utc]" {
+		t.Fatalf("claimed %v, want [due-offset due-utc]", names)
+	}
+	claimed, err = repo.ClaimDueTasks("b", now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 0 {
+		t.Fatalf("b claimed %d leased tasks", len(claimed))
+	}
+	claimed, err = repo.ClaimDueTasks("b", now.Add(LeaseDuration), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claimed) != 2 {
+		t.Fatalf("b claimed %d tasks after the lease expired, want 2", len(claimed))
+	}
+	if _, err := repo.RenewLease("due-utc-id", "a", now); err == nil {
+		t.Fatal("a renewed a lease claimed by b")
+	}
+}
+
+func TestPausedTasksDoNotRun(t *testing.T) {
+	repo := newTestRepo(t)
+	newTestTask(t, repo, "extract", time.Now())
+	newTestTask(t, repo, "load", time.Now())
+	newTestTask(t, repo, "notify", time.Now())
+	if err := repo.SetDependencies("load", []string{"extract"}, dto.DependsOnSuccess); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"load", "notify"} {
+		if err := repo.SetSubscriptions(name, "done"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.PauseTask(name+"-id", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run, err := repo.StartTaskRun("extract-id", TriggerSchedule, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.FinishTaskRun(run.RunId, 0, ""); err != nil {
+		t.Fatal(err)
+	}
+	if runnable, err := repo.DownstreamRunnable("extract", true); err != nil || len(runnable) != 0 {
+		t.Fatalf("DownstreamRunnable = %d tasks, %v, want none", len(runnable), err)
+	}
+	if subscribers, err := repo.GetSubscribers("done"); err != nil || len(subscribers) != 0 {
+		t.Fatalf("GetSubscribers = %d tasks, %v, want none", len(subscribers), err)
+	}
+	if decision, err := repo.AcquireRunSlot("load-id"); err != nil || decision != RunSkip {
+		t.Fatalf("AcquireRunSlot = %v, %v, want skip", decision, err)
+	}
+
+	before := time.Now()
+	task, err := repo.ResumeTask("load-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.IsPaused || task.ResumedAt == nil || task.MisfireBaseline().Before(before.Truncate(time.Second)) {
+		t.Fatalf("resumed task paused %t resumed at %v", task.IsPaused, task.ResumedAt)
+	}
+	runnable, err := repo.DownstreamRunnable("extract", true)
+	if err != nil || len(runnable) != 1 || runnable[0].Name != "load" {
+		t.Fatalf("DownstreamRunnable = %v, %v, want load", runnable, err)
+	}
+
+	until := time.Now().Add(-time.Minute)
+	if _, err := repo.PauseTask("notify-id", &until); err != nil {
+		t.Fatal(err)
+	}
+	subscribers, err := repo.GetSubscribers("done")
+	if err != nil || len(subscribers) != 2 {
+		t.Fatalf("GetSubscribers = %d tasks, %v, want both once the pause expired", len(subscribers), err)
+	}
+	if n, err := repo.ResumeExpiredPauses(time.Now()); err != nil || n != 1 {
+		t.Fatalf("ResumeExpiredPauses = %d, %v, want 1", n, err)
+	}
+	if task := getTask(t, repo, "notify"); task.ResumedAt == nil || !task.ResumedAt.Equal(until) {
+		t.Fatalf("expired pause resumed at %v, want %v", task.ResumedAt, until)
+	}
+}
+
+func TestFinishTaskRunRecordsErrorTxt(t *testing.T) {
+	repo := newTestRepo(t)
+	newTestTask(t, repo, "job", time.Now())
+	finish := func(exitCode int, errTxt string) {
+		t.Helper()
+		run, err := repo.StartTaskRun("job-id", TriggerSchedule, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run, err = repo.FinishTaskRun(run.RunId, exitCode, errTxt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if run.ErrorTxt != errTxt {
+			t.Fatalf("run ErrorTxt = %q, want %q", run.ErrorTxt, errTxt)
+		}
+	}
+	stack := "task panicked: boom\n\ngoroutine 1 [running]:\nmain.Function()"
+	finish(1, stack)
+	if task := getTask(t, repo, "job"); task.ErrorTxt != stack {
+		t.Fatalf("task ErrorTxt = %q, want the failed run's stderr", task.ErrorTxt)
+	}
+	finish(0, "")
+	if task := getTask(t, repo, "job"); task.ErrorTxt != stack {
+		t.Fatalf("a successful run changed the task's ErrorTxt to %q", task.ErrorTxt)
+	}
+}
+
+// startRuns records n runs of the task with the provided taskID, started a minute apart from start
+func startRuns(t *testing.T, repo *Repo, taskID string, start time.Time, n int) []*TaskRunModel {
+	t.Helper()
+	runs := make([]*TaskRunModel, 0, n)
+	for i := 0; i < n; i++ {
+		run, err := repo.StartTaskRun(taskID, TriggerSchedule, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		run.StartedAt = start.Add(time.Duration(i) * time.Minute)
+		if err := repo.DB.Save(run).Error; err != nil {
+			t.Fatal(err)
+		}
+		runs = append(runs, run)
+	}
+	return runs
+}
+
+func TestGetTaskRuns(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Now().Add(-time.Hour)
+	runs := startRuns(t, repo, "job-id", start, 5)
+	startRuns(t, repo, "other-id", start, 2)
+	tests := []struct {
+		offset int
+		limit  int
+		want   []string
+	}{
+		{0, 2, []string{runs[4].RunId, runs[3].RunId}},
+		{1, 2, []string{runs[3].RunId, runs[2].RunId}},
+		{4, 10, []string{runs[0].RunId}},
+		{5, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("offset %d limit %d", tt.offset, tt.limit), func(t *testing.T) {
+			page, total, err := repo.GetTaskRuns("job-id", tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 5 {
+				t.Errorf("total = %d, want 5", total)
+			}
+			var got []string
+			for _, run := range page {
+				got = append(got, run.RunId)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Errorf("page = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, _, err := repo.GetTaskRuns("job-id", -1, 2); err == nil {
+		t.Error("GetTaskRuns accepted a negative offset")
+	}
+	if _, _, err := repo.GetTaskRuns("job-id", 0, 0); err == nil {
+		t.Error("GetTaskRuns accepted an empty page")
+	}
+}
+
+func TestPruneTaskRuns(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Now().Add(-time.Hour)
+	runs := startRuns(t, repo, "job-id", start, 4)
+	for _, run := range []*TaskRunModel{runs[0], runs[1], runs[3]} {
+		if _, err := repo.FinishTaskRun(run.RunId, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//runs[2] is still in progress & runs[3] started after the cutoff
+	deleted, err := repo.PruneTaskRuns(start.Add(150 * time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 2 {
+		t.Fatalf("PruneTaskRuns deleted %d runs, want 2", deleted)
+	}
+	if _, total, err := repo.GetTaskRuns("job-id", 0, 10); err != nil || total != 2 {
+		t.Fatalf("%d runs left, %v, want 2", total, err)
+	}
+	if _, err := repo.FinishTaskRun(runs[2].RunId, 1, "failed"); err != nil {
+		t.Fatalf("finishing a run in progress after pruning: %v", err)
+	}
+}
+
+func TestDownstreamRunnable(t *testing.T) {
+	repo := newTestRepo(t)
+	for _, name := range []string{"extract", "load", "report", "archive", "cleanup"} {
+		newTestTask(t, repo, name, time.Now())
+	}
+	for _, name := range []string{"load", "archive", "cleanup"} {
+		if err := repo.SetDependencies(name, []string{"extract"}, dto.DependsOnSuccess); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetDependencies("report", []string{"extract"}, dto.DependsOnFailure); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsDisabled("archive", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsCompleted("cleanup"); err != nil {
+		t.Fatal(err)
+	}
+	finish := func(exitCode int) {
+		t.Helper()
+		run, err := repo.StartTaskRun("extract-id", TriggerSchedule, 1, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.FinishTaskRun(run.RunId, exitCode, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		succeeded bool
+		want      string
+	}{
+		{true, "[load]"},
+		{false, "[report]"},
+	}
+	for _, tt := range tests {
+		exitCode := 0
+		if !tt.succeeded {
+			exitCode = 1
+		}
+		finish(exitCode)
+		runnable, err := repo.DownstreamRunnable("extract", tt.succeeded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, task := range runnable {
+			names = append(names, task.Name)
+		}
+		if fmt.Sprint(names) != tt.want {
+			t.Errorf("DownstreamRunnable(succeeded %t) = %v, want %v", tt.succeeded, names, tt.want)
+		}
+	}
+}
+
+func TestGetSubscribers(t *testing.T) {
+	repo := newTestRepo(t)
+	for _, name := range []string{"email", "audit", "archive", "cleanup", "other"} {
+		newTestTask(t, repo, name, time.Now())
+	}
+	for _, name := range []string{"email", "audit", "archive", "cleanup"} {
+		if err := repo.SetSubscriptions(name, "orders.created", "orders.paid"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := repo.SetSubscriptions("other", "orders.paid"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsDisabled("archive", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.SetIsCompleted("cleanup"); err != nil {
+		t.Fatal(err)
+	}
+	subscribers, err := repo.GetSubscribers("orders.created")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, task := range subscribers {
+		names = append(names, task.Name)
+	}
+	if fmt.Sprint(names) != "[audit email]" {
+		t.Fatalf("GetSubscribers = %v, want [audit email]", names)
+	}
+	if events, err := repo.GetSubscriptions("email"); err != nil || fmt.Sprint(events) != "[orders.created orders.paid]" {
+		t.Fatalf("GetSubscriptions = %v, %v", events, err)
+	}
+	//re-subscribing replaces the task's events
+	if err := repo.SetSubscriptions("email"); err != nil {
+		t.Fatal(err)
+	}
+	if events, err := repo.GetSubscriptions("email"); err != nil || len(events) != 0 {
+		t.Fatalf("GetSubscriptions after unsubscribing = %v, %v", events, err)
+	}
+}
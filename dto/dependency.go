@@ -0,0 +1,23 @@
+package dto
+
+/*
+DependencyCondition decides which outcome of an upstream task triggers its dependents
+*/
+type DependencyCondition string
+
+const (
+	//DependsOnSuccess runs the dependent task once all of its upstream tasks succeed
+	DependsOnSuccess DependencyCondition = "success"
+	//DependsOnFailure runs the dependent task when any of its upstream tasks fails
+	DependsOnFailure DependencyCondition = "failure"
+)
+
+/*
+Dependency is an edge of a workflow, Task runs after Upstream according to Condition.
+Tasks are referred to by name.
+*/
+type Dependency struct {
+	Task      string              `json:"task"`
+	Upstream  string              `json:"upstream"`
+	Condition DependencyCondition `json:"condition"`
+}
@@ -7,12 +7,12 @@ import (
 type TaskInfo struct {
 	TaskID            string
 	Name              string
-	Description       string                 `json:"description"`
-	Schedule          map[string]interface{} `json:"scheduleInfo"`
+	Description       string       `json:"description"`
+	Schedule          ScheduleSpec `json:"scheduleInfo"`
 	NextExecutionTime *time.Time
 	LastExecutionTime *time.Time
 	Ch                chan bool
-	RetryPolicy       map[string]int
+	RetryPolicy       map[string]interface{}
 	Status            string
 	LogPath           string
 	Slug              string
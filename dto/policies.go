@@ -0,0 +1,78 @@
+package dto
+
+import (
+	"fmt"
+	"time"
+)
+
+type MisfireKind string
+
+const (
+	MisfireFireOnce     MisfireKind = "fireOnce"
+	MisfireFireAll      MisfireKind = "fireAll"
+	MisfireSkip         MisfireKind = "skip"
+	MisfireFireIfWithin MisfireKind = "fireIfWithin"
+)
+
+/*
+MisfirePolicy decides what happens to runs that were missed e.g while the
+scheduler was down. The zero value behaves like MisfireFireOnce.
+*/
+type MisfirePolicy struct {
+	Kind     MisfireKind   `json:"kind,omitempty"`
+	MaxCount int           `json:"maxCount,omitempty"`
+	Within   time.Duration `json:"within,omitempty"`
+}
+
+func (p MisfirePolicy) String() string {
+	switch p.Kind {
+	case MisfireFireAll:
+		return fmt.Sprintf("%s:%d", p.Kind, p.MaxCount)
+	case MisfireFireIfWithin:
+		return fmt.Sprintf("%s:%v", p.Kind, p.Within)
+	case "":
+		return string(MisfireFireOnce)
+	}
+	return string(p.Kind)
+}
+
+/*
+ConcurrencyPolicy decides what happens when a run is due while
+previous runs of the same task are still executing. The zero
+value behaves like ConcurrencyForbid.
+*/
+type ConcurrencyPolicy string
+
+const (
+	//ConcurrencyForbid skips the new run
+	ConcurrencyForbid ConcurrencyPolicy = "forbid"
+	//ConcurrencyAllow starts the new run alongside the running ones, up to MaxConcurrent
+	ConcurrencyAllow ConcurrencyPolicy = "allow"
+	//ConcurrencyReplace stops the running ones and starts the new run
+	ConcurrencyReplace ConcurrencyPolicy = "replace"
+	//ConcurrencyQueue starts the new run once a running one finishes
+	ConcurrencyQueue ConcurrencyPolicy = "queue"
+)
+
+/*
+RetryPolicySpec is the stored form of a task's retry policy,
+used to retry a failed task at the process level
+*/
+type RetryPolicySpec struct {
+	Tries    int64         `json:"tries"`
+	Delay    time.Duration `json:"delay"`
+	Backoff  float64       `json:"backoff"`
+	MaxDelay time.Duration `json:"maxDelay,omitempty"`
+	Jitter   string        `json:"jitter,omitempty"`
+}
+
+// Map returns the policy in a form that can be shown to operators e.g through TaskInfo
+func (p *RetryPolicySpec) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"tries":    p.Tries,
+		"backoff":  p.Backoff,
+		"delay":    p.Delay.String(),
+		"maxDelay": p.MaxDelay.String(),
+		"jitter":   p.Jitter,
+	}
+}
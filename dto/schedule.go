@@ -0,0 +1,249 @@
+package dto
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ScheduleSpecVersion is the version written to newly built ScheduleSpecs
+const ScheduleSpecVersion = 2
+
+/*
+ScheduleSpec is the typed schedule information of a task. Type holds the
+task type (HMS, DayTime, Monthly, Yearly, Once, Cron, Dependent, Event,
+FileWatch) and decides which of
+the remaining fields are set.
+
+Version history:
+  - 1: single Day & Time for DayTime tasks
+  - 2: Days & Times lists for DayTime tasks
+*/
+type ScheduleSpec struct {
+	Version  int      `json:"version"`
+	Type     string   `json:"type"`
+	Interval int64    `json:"interval,omitempty"`
+	Units    string   `json:"units,omitempty"`
+	Days     []string `json:"days,omitempty"`
+	Times    []string `json:"times,omitempty"`
+	//Months, MonthDay, LastDay, Nth & Weekday describe Monthly & Yearly tasks
+	Months   []string   `json:"months,omitempty"`
+	MonthDay int        `json:"monthDay,omitempty"`
+	LastDay  bool       `json:"lastDay,omitempty"`
+	Nth      int        `json:"nth,omitempty"`
+	Weekday  string     `json:"weekday,omitempty"`
+	RunAt    *time.Time `json:"runAt,omitempty"`
+	//RunAfter is set when RunAt was scheduled relative to the time the task was first saved
+	RunAfter time.Duration `json:"runAfter,omitempty"`
+	Cron     string        `json:"cron,omitempty"`
+	TimeZone string        `json:"timeZone,omitempty"`
+	//SkipCalendars & BusinessDays exclude dates from any of the schedules above
+	SkipCalendars []string `json:"skipCalendars,omitempty"`
+	BusinessDays  bool     `json:"businessDays,omitempty"`
+	//StartAt, EndAt & Blackouts limit when any of the schedules above runs, runs outside them are skipped
+	StartAt   *time.Time  `json:"startAt,omitempty"`
+	EndAt     *time.Time  `json:"endAt,omitempty"`
+	Blackouts []TimeRange `json:"blackouts,omitempty"`
+	//After & AfterOn describe Dependent tasks, which run when their upstream tasks finish
+	After   []string            `json:"after,omitempty"`
+	AfterOn DependencyCondition `json:"afterOn,omitempty"`
+	//Event describes Event tasks, which run when the event is published on the bus
+	Event string `json:"event,omitempty"`
+	//Glob, FileEvent & Debounce describe FileWatch tasks, which run when files matching Glob change
+	Glob      string        `json:"glob,omitempty"`
+	FileEvent FileEvent     `json:"fileEvent,omitempty"`
+	Debounce  time.Duration `json:"debounce,omitempty"`
+	//Day & Time are only read from version 1 specs and moved into Days & Times
+	Day  string `json:"day,omitempty"`
+	Time string `json:"time,omitempty"`
+}
+
+/*
+UnmarshalJSON decodes a ScheduleSpec, upgrading unversioned schedule info
+(stored as a plain map before ScheduleSpec existed) to the current version.
+*/
+func (s *ScheduleSpec) UnmarshalJSON(data []byte) error {
+	type spec ScheduleSpec
+	var v spec
+	if err := json.Unmarshal(data, &v); err != nil {
+		return fmt.Errorf("invalid schedule spec: %w", err)
+	}
+	*s = ScheduleSpec(v)
+	if s.Version < ScheduleSpecVersion {
+		s.upgrade()
+	}
+	return nil
+}
+
+func (s *ScheduleSpec) upgrade() {
+	if s.Version < 1 && len(s.Type) == 0 {
+		switch {
+		case len(s.Cron) > 0:
+			s.Type = "Cron"
+		case s.Interval > 0:
+			s.Type = "HMS"
+		case len(s.Day) > 0 && len(s.Time) > 0:
+			s.Type = "DayTime"
+		}
+	}
+	if s.Version < 2 {
+		if len(s.Day) > 0 {
+			s.Days = []string{s.Day}
+		}
+		if len(s.Time) > 0 {
+			s.Times = []string{s.Time}
+		}
+		s.Day = ""
+		s.Time = ""
+	}
+	s.Version = ScheduleSpecVersion
+}
+
+/*
+String returns the canonical form of the schedule e.g `interval:10,units:seconds`.
+Fields always appear in the same order so the result can be stored and compared.
+*/
+func (s *ScheduleSpec) String() string {
+	var parts []string
+	add := func(k string, v string) {
+		if len(v) > 0 {
+			parts = append(parts, fmt.Sprintf("%s:%s", k, v))
+		}
+	}
+	if s.Interval != 0 {
+		add("interval", fmt.Sprint(s.Interval))
+	}
+	add("units", s.Units)
+	add("months", strings.Join(s.Months, "|"))
+	if s.MonthDay != 0 {
+		add("monthDay", fmt.Sprint(s.MonthDay))
+	}
+	if s.LastDay {
+		add("lastDay", "true")
+	}
+	if s.Nth != 0 {
+		add("nth", fmt.Sprint(s.Nth))
+	}
+	add("weekday", s.Weekday)
+	add("days", strings.Join(s.Days, "|"))
+	add("times", strings.Join(s.Times, "|"))
+	if s.RunAt != nil {
+		add("runAt", s.RunAt.Format(time.RFC3339))
+	}
+	if s.RunAfter != 0 {
+		add("runAfter", s.RunAfter.String())
+	}
+	add("cron", s.Cron)
+	add("timeZone", s.TimeZone)
+	add("skipCalendars", strings.Join(s.SkipCalendars, "|"))
+	if s.BusinessDays {
+		add("businessDays", "true")
+	}
+	if s.StartAt != nil {
+		add("startAt", s.StartAt.Format(time.RFC3339))
+	}
+	if s.EndAt != nil {
+		add("endAt", s.EndAt.Format(time.RFC3339))
+	}
+	blackouts := make([]string, 0, len(s.Blackouts))
+	for _, b := range s.Blackouts {
+		blackouts = append(blackouts, fmt.Sprintf("%s~%s", b.Start.Format(time.RFC3339), b.End.Format(time.RFC3339)))
+	}
+	add("blackouts", strings.Join(blackouts, "|"))
+	add("after", strings.Join(s.After, "|"))
+	add("afterOn", string(s.AfterOn))
+	add("event", s.Event)
+	add("glob", s.Glob)
+	add("fileEvent", string(s.FileEvent))
+	if s.Debounce != 0 {
+		add("debounce", s.Debounce.String())
+	}
+	return strings.Join(parts, ",")
+}
+
+// CalendarDateLayout is the layout of the dates held by a Calendar
+const CalendarDateLayout = "2006-01-02"
+
+/*
+Calendar is a named set of dates on which scheduled
+tasks referencing it should not run e.g public holidays
+*/
+type Calendar struct {
+	Name  string   `json:"name"`
+	Dates []string `json:"dates"`
+}
+
+/*NewCalendar returns a Calendar holding the provided dates (in CalendarDateLayout)*/
+func NewCalendar(name string, dates []string) (*Calendar, error) {
+	seen := make(map[string]bool)
+	cal := &Calendar{
+		Name:  name,
+		Dates: make([]string, 0, len(dates)),
+	}
+	for _, d := range dates {
+		if _, err := time.Parse(CalendarDateLayout, d); err != nil {
+			return nil, fmt.Errorf("invalid date %q in calendar %v, should be in format %v", d, name, CalendarDateLayout)
+		}
+		if !seen[d] {
+			seen[d] = true
+			cal.Dates = append(cal.Dates, d)
+		}
+	}
+	sort.Strings(cal.Dates)
+	return cal, nil
+}
+
+/*Contains returns true if the date of t (in t's location) is in the calendar*/
+func (c *Calendar) Contains(t time.Time) bool {
+	d := t.Format(CalendarDateLayout)
+	i := sort.SearchStrings(c.Dates, d)
+	return i < len(c.Dates) && c.Dates[i] == d
+}
+
+/*TimeRange is the period [Start, End) e.g a maintenance blackout*/
+type TimeRange struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+/*Contains returns true if t falls within the range*/
+func (r TimeRange) Contains(t time.Time) bool {
+	return !t.Before(r.Start) && t.Before(r.End)
+}
+
+/*
+Location returns the time zone of the schedule, or nil
+when the schedule uses the workspace TIME_ZONE
+*/
+func (s *ScheduleSpec) Location() (*time.Location, error) {
+	if len(s.TimeZone) == 0 {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schedule time zone %v: %w", s.TimeZone, err)
+	}
+	return loc, nil
+}
+
+/*Equal returns true if both specs describe the same schedule*/
+func (s *ScheduleSpec) Equal(o *ScheduleSpec) bool {
+	if s == nil || o == nil {
+		return s == o
+	}
+	return s.Type == o.Type && s.String() == o.String()
+}
+
+/*
+FileEvent decides which changes to a watched file trigger a FileWatch task
+*/
+type FileEvent string
+
+const (
+	//FileCreated triggers when a file is created in or moved into the watched directory
+	FileCreated FileEvent = "created"
+	//FileChanged triggers when a file is created, moved in or written to
+	FileChanged FileEvent = "changed"
+)
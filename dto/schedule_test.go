@@ -0,0 +1,59 @@
+package dto
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestScheduleSpecUpgrade(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want ScheduleSpec
+	}{
+		{
+			name: "unversioned interval",
+			data: `{"interval":10,"units":"seconds"}`,
+			want: ScheduleSpec{Version: ScheduleSpecVersion, Type: "HMS", Interval: 10, Units: "seconds"},
+		},
+		{
+			name: "unversioned day & time",
+			data: `{"day":"monday","time":"09:30"}`,
+			want: ScheduleSpec{Version: ScheduleSpecVersion, Type: "DayTime", Days: []string{"monday"}, Times: []string{"09:30"}},
+		},
+		{
+			name: "unversioned cron",
+			data: `{"cron":"30 9 * * 1-5"}`,
+			want: ScheduleSpec{Version: ScheduleSpecVersion, Type: "Cron", Cron: "30 9 * * 1-5"},
+		},
+		{
+			name: "version 1 day & time",
+			data: `{"version":1,"type":"DayTime","day":"friday","time":"17:00","timeZone":"Africa/Nairobi"}`,
+			want: ScheduleSpec{Version: ScheduleSpecVersion, Type: "DayTime", Days: []string{"friday"}, Times: []string{"17:00"}, TimeZone: "Africa/Nairobi"},
+		},
+		{
+			name: "current version",
+			data: `{"version":2,"type":"DayTime","days":["monday","friday"],"times":["09:00","17:00"]}`,
+			want: ScheduleSpec{Version: ScheduleSpecVersion, Type: "DayTime", Days: []string{"monday", "friday"}, Times: []string{"09:00", "17:00"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec ScheduleSpec
+			if err := json.Unmarshal([]byte(tt.data), &spec); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(spec, tt.want) {
+				t.Errorf("spec = %+v, want %+v", spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestScheduleSpecInvalid(t *testing.T) {
+	var spec ScheduleSpec
+	if err := json.Unmarshal([]byte(`{"interval":"ten"}`), &spec); err == nil {
+		t.Fatal("Unmarshal succeeded, want an error")
+	}
+}
@@ -23,6 +23,7 @@ var (
 	}
 	WORKSPACE          = filepath.Join(os.Getenv("HOME"), "keiji")
 	TASKS_PATH         = filepath.Join(WORKSPACE, "tasks")
+	CALENDARS_PATH     = filepath.Join(WORKSPACE, "calendars")
 	WORKSPACE_SETTINGS = filepath.Join(WORKSPACE, "settings.conf")
 	WORKSPACE_MODULE   = filepath.Join(WORKSPACE, "go.mod")
 	TASK_LOG_DIR       = func(taskName string) string {
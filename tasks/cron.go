@@ -0,0 +1,150 @@
+package tasks
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+cronSchedule holds a parsed five field cron expression
+(minute hour day-of-month month day-of-week) as bitsets.
+*/
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+	//domStar & dowStar record wether the day fields were `*`, which
+	//decides if the two day fields are combined with AND or OR
+	domStar bool
+	dowStar bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names map[string]int
+}
+
+var (
+	cronMinute = cronField{"minute", 0, 59, nil}
+	cronHour   = cronField{"hour", 0, 23, nil}
+	cronDom    = cronField{"day-of-month", 1, 31, nil}
+	cronMonth  = cronField{"month", 1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	//day-of-week accepts 7 as an alias for sunday
+	cronDow = cronField{"day-of-week", 0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+// parseCron parses a standard five field cron expression e.g `30 9 * * 1-5`.
+// Each field accepts `*`, single values, ranges `a-b`, steps `*/n` or `a-b/n`
+// and comma separated lists of the above. Month and day-of-week fields also accept
+// three letter names e.g `jan`, `mon-fri`.
+func parseCron(expr string) (*cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression %q should have 5 fields (minute hour day-of-month month day-of-week), got %d", expr, len(fields))
+	}
+	var err error
+	cs := &cronSchedule{}
+	if cs.minute, err = parseCronField(fields[0], cronMinute); err != nil {
+		return nil, err
+	}
+	if cs.hour, err = parseCronField(fields[1], cronHour); err != nil {
+		return nil, err
+	}
+	if cs.dom, err = parseCronField(fields[2], cronDom); err != nil {
+		return nil, err
+	}
+	if cs.month, err = parseCronField(fields[3], cronMonth); err != nil {
+		return nil, err
+	}
+	if cs.dow, err = parseCronField(fields[4], cronDow); err != nil {
+		return nil, err
+	}
+	//fold 7 (sunday) into 0
+	if cs.dow&(1<<7) != 0 {
+		cs.dow = (cs.dow | 1) &^ (1 << 7)
+	}
+	cs.domStar = strings.HasPrefix(fields[2], "*")
+	cs.dowStar = strings.HasPrefix(fields[4], "*")
+	return cs, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		b, err := parseCronPart(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+func parseCronPart(part string, f cronField) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(part, "/")
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepPart)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid step %q in %s field", stepPart, f.name)
+		}
+		step = n
+	}
+	var start, end int
+	switch {
+	case rangePart == "*":
+		start, end = f.min, f.max
+	case strings.Contains(rangePart, "-"):
+		lo, hi, _ := strings.Cut(rangePart, "-")
+		var err error
+		if start, err = f.value(lo); err != nil {
+			return 0, err
+		}
+		if end, err = f.value(hi); err != nil {
+			return 0, err
+		}
+		if start > end {
+			return 0, fmt.Errorf("invalid range %q in %s field", rangePart, f.name)
+		}
+	default:
+		v, err := f.value(rangePart)
+		if err != nil {
+			return 0, err
+		}
+		start = v
+		end = v
+		if hasStep {
+			//`a/n` means every n starting at a
+			end = f.max
+		}
+	}
+	var bits uint64
+	for i := start; i <= end; i += step {
+		bits |= 1 << uint(i)
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q in %s field", s, f.name)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("value %d out of range [%d-%d] in %s field", v, f.min, f.max, f.name)
+	}
+	return v, nil
+}
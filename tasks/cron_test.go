@@ -0,0 +1,101 @@
+package tasks
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"a * * * *",
+	}
+	for _, expr := range tests {
+		t.Run(expr, func(t *testing.T) {
+			if _, err := parseCron(expr); err == nil {
+				t.Fatalf("parseCron(%q) succeeded", expr)
+			}
+		})
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(d, hh, mm int) time.Time {
+		return time.Date(2026, time.March, d, hh, mm, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		{"* * * * *", at(2, 10, 0), at(2, 10, 1)},
+		{"* * * * *", at(2, 10, 0).Add(30 * time.Second), at(2, 10, 1)},
+		{"*/15 * * * *", at(2, 10, 1), at(2, 10, 15)},
+		{"5/20 * * * *", at(2, 10, 30), at(2, 10, 45)},
+		{"0 9-17/4 * * *", at(2, 13, 0), at(2, 17, 0)},
+		{"0,30 8 * * *", at(2, 8, 0), at(2, 8, 30)},
+		{"30 9 * * mon-fri", at(6, 10, 0), at(9, 9, 30)},
+		{"0 12 * * 7", at(2, 0, 0), at(8, 12, 0)},
+		{"0 12 * * sun", at(2, 0, 0), at(8, 12, 0)},
+		{"0 0 1 * *", at(2, 0, 0), time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * jun *", at(2, 0, 0), time.Date(2026, time.June, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", at(31, 1, 0), time.Date(2026, time.May, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", at(2, 0, 0), time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		//day-of-month & day-of-week match either when neither is `*`
+		{"0 0 10 * fri", at(2, 0, 0), at(6, 0, 0)},
+		{"0 0 5 * fri", at(2, 0, 0), at(5, 0, 0)},
+		//and both when either is `*`
+		{"0 0 */10 * fri", at(2, 0, 0), time.Date(2026, time.May, 1, 0, 0, 0, 0, time.UTC)},
+		{"59 23 31 12 *", at(2, 0, 0), time.Date(2026, time.December, 31, 23, 59, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			cs, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := cs.next(tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("next(%v) = %v, want %v", tt.after, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronValidate(t *testing.T) {
+	tests := []struct {
+		expr  string
+		valid bool
+	}{
+		{"30 9 * * 1-5", true},
+		{"0 0 29 2 *", true},
+		{"0 0 30 2 *", false},
+		{"0 0 31 4,6,9,11 *", false},
+		{"0 0 31 * *", true},
+		{"61 * * * *", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			err := NewSchedule().Cron(tt.expr).Validate()
+			if tt.valid && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("Validate() = nil, want an error")
+			}
+		})
+	}
+}
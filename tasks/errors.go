@@ -0,0 +1,75 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+)
+
+/*
+PermanentError wraps an error that should not be retried,
+see Permanent
+*/
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent error: %v", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+/*
+Permanent marks err as permanent, a task function returning it is
+not retried regardless of its RetryPolicy. Permanent(nil) returns nil.
+*/
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{
+		Err: err,
+	}
+}
+
+/*
+PanicError is returned when a task function panics,
+it carries the panic value and the stack of the panicking goroutine.
+Error only returns the panic value, see ErrorText for the stack.
+*/
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("task panicked: %v", e.Value)
+}
+
+/*
+Unwrap returns the panic value if it is an error e.g panic(err)
+*/
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+/*
+ErrorText returns the text recorded as a failed run's error, i.e err's message
+followed by the stack when err is or wraps a *PanicError. The task binary writes it
+to stderr, which the scheduler passes as errTxt to db.Repo.FinishTaskRun.
+*/
+func ErrorText(err error) string {
+	if err == nil {
+		return ""
+	}
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return fmt.Sprintf("%v\n\n%s", err, panicErr.Stack)
+	}
+	return err.Error()
+}
@@ -0,0 +1,145 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+// maxMisfireScan bounds the number of missed runs OwedRuns will walk through
+const maxMisfireScan = 1000000
+
+// FireOnce fires a single run for any number of missed runs
+func FireOnce() dto.MisfirePolicy {
+	return dto.MisfirePolicy{Kind: dto.MisfireFireOnce}
+}
+
+// FireAll fires every missed run, up to the max most recent ones
+func FireAll(max int) dto.MisfirePolicy {
+	return dto.MisfirePolicy{Kind: dto.MisfireFireAll, MaxCount: max}
+}
+
+// Skip drops missed runs, the task resumes at its next scheduled time
+func Skip() dto.MisfirePolicy {
+	return dto.MisfirePolicy{Kind: dto.MisfireSkip}
+}
+
+// FireIfWithin fires a single run if the most recent missed run is no older than d
+func FireIfWithin(d time.Duration) dto.MisfirePolicy {
+	return dto.MisfirePolicy{Kind: dto.MisfireFireIfWithin, Within: d}
+}
+
+/*
+OwedRuns returns the scheduled run times in (lastRun, now] that should still be
+fired according to policy, oldest first. loc & calendars are used as in NextRun.
+Pass db.TaskModel.MisfireBaseline as lastRun so runs that fell inside a pause are skipped.
+*/
+func OwedRuns(spec *dto.ScheduleSpec, policy dto.MisfirePolicy, lastRun time.Time, now time.Time, loc *time.Location, calendars ...*dto.Calendar) ([]time.Time, error) {
+	if policy.Kind == dto.MisfireSkip {
+		return nil, nil
+	}
+	keep := 1
+	if policy.Kind == dto.MisfireFireAll && policy.MaxCount > 0 {
+		keep = policy.MaxCount
+	}
+	//only the most recent `keep` missed runs are retained
+	missed := make([]time.Time, 0, 2*keep+1)
+	after := lastRun
+	var skip func(next time.Time) time.Time
+	if TaskType(spec.Type) == HMSTask {
+		var err error
+		if skip, err = intervalSkipper(spec, now, keep, loc, calendars); err != nil {
+			return nil, err
+		}
+	}
+	for i := 0; ; i++ {
+		if i >= maxMisfireScan {
+			return nil, fmt.Errorf("more than %d missed runs since %v", maxMisfireScan, lastRun)
+		}
+		next, err := NextRun(spec, after, loc, calendars...)
+		if errors.Is(err, ErrNoNextRun) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if next.After(now) {
+			break
+		}
+		if skip != nil {
+			next = skip(next)
+		}
+		missed = append(missed, next)
+		if len(missed) > 2*keep {
+			missed = append(missed[:0], missed[len(missed)-keep:]...)
+		}
+		after = next
+	}
+	if len(missed) == 0 {
+		return nil, nil
+	}
+	if len(missed) > keep {
+		missed = missed[len(missed)-keep:]
+	}
+	switch policy.Kind {
+	case dto.MisfireFireIfWithin:
+		latest := missed[len(missed)-1]
+		if now.Sub(latest) > policy.Within {
+			return nil, nil
+		}
+		return missed, nil
+	case dto.MisfireFireAll:
+		return missed, nil
+	case dto.MisfireFireOnce, "":
+		return missed[len(missed)-1:], nil
+	}
+	return nil, fmt.Errorf("unknown misfire policy: %v", policy.Kind)
+}
+
+/*
+intervalSkipper returns a function that moves the run time next of an interval (HMS) spec
+forward by whole intervals, up to keep runs before now or before the next excluded date or
+blackout. Interval runs are evenly spaced between those, so OwedRuns can skip the runs it
+would drop instead of walking each of them.
+*/
+func intervalSkipper(spec *dto.ScheduleSpec, now time.Time, keep int, loc *time.Location, calendars []*dto.Calendar) (func(time.Time) time.Time, error) {
+	d, err := intervalDuration(spec)
+	if err != nil {
+		return nil, err
+	}
+	loc, err = scheduleLocation(spec, loc)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := exclusions(spec, calendars)
+	if err != nil {
+		return nil, err
+	}
+	return func(next time.Time) time.Time {
+		end := now
+		if spec.EndAt != nil && spec.EndAt.Before(end) {
+			end = *spec.EndAt
+		}
+		for _, b := range spec.Blackouts {
+			//next is not blacked out, so a blackout ending after it starts after it
+			if b.End.After(next) && b.Start.Before(end) {
+				end = b.Start
+			}
+		}
+		next = next.In(loc)
+		for day := time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+			if excluded(day) {
+				end = day
+				break
+			}
+		}
+		//runs next + i*d for i <= last fall before end
+		last := int64((end.Sub(next) - time.Nanosecond) / d)
+		if n := last - int64(keep); n > 0 {
+			return next.Add(time.Duration(n) * d)
+		}
+		return next
+	}, nil
+}
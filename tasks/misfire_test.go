@@ -0,0 +1,120 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+// walkMissed returns every run in (lastRun, now] by calling NextRun repeatedly
+func walkMissed(t *testing.T, spec *dto.ScheduleSpec, lastRun, now time.Time, calendars ...*dto.Calendar) []time.Time {
+	t.Helper()
+	var runs []time.Time
+	for after := lastRun; ; {
+		next, err := NextRun(spec, after, time.UTC, calendars...)
+		if errors.Is(err, ErrNoNextRun) {
+			return runs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next.After(now) {
+			return runs
+		}
+		runs = append(runs, next)
+		after = next
+	}
+}
+
+func TestOwedRunsIntervalMatchesWalk(t *testing.T) {
+	lastRun := time.Date(2026, 3, 5, 9, 0, 0, 0, time.UTC)
+	holidays, err := dto.NewCalendar("holidays", []string{"2026-03-09"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blackout := dto.TimeRange{Start: lastRun.Add(50 * time.Hour), End: lastRun.Add(53*time.Hour + 7*time.Minute)}
+	endAt := lastRun.Add(5 * 24 * time.Hour)
+	tests := []struct {
+		name string
+		spec dto.ScheduleSpec
+	}{
+		{"plain", dto.ScheduleSpec{Type: string(HMSTask), Interval: 7, Units: "minutes"}},
+		{"business days", dto.ScheduleSpec{Type: string(HMSTask), Interval: 7, Units: "minutes", BusinessDays: true}},
+		{"calendar", dto.ScheduleSpec{Type: string(HMSTask), Interval: 7, Units: "minutes", SkipCalendars: []string{"holidays"}}},
+		{"blackout", dto.ScheduleSpec{Type: string(HMSTask), Interval: 7, Units: "minutes", Blackouts: []dto.TimeRange{blackout}}},
+		{"end", dto.ScheduleSpec{Type: string(HMSTask), Interval: 7, Units: "minutes", EndAt: &endAt}},
+	}
+	for _, tt := range tests {
+		for _, now := range []time.Time{lastRun.Add(3 * time.Minute), lastRun.Add(52 * time.Hour), lastRun.Add(9*24*time.Hour + 5*time.Minute)} {
+			for _, keep := range []int{1, 3, 50} {
+				t.Run(fmt.Sprintf("%v/%v/%d", tt.name, now.Sub(lastRun), keep), func(t *testing.T) {
+					walked := walkMissed(t, &tt.spec, lastRun, now, holidays)
+					if len(walked) > keep {
+						walked = walked[len(walked)-keep:]
+					}
+					owed, err := OwedRuns(&tt.spec, FireAll(keep), lastRun, now, time.UTC, holidays)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if fmt.Sprint(owed) != fmt.Sprint(walked) {
+						t.Errorf("OwedRuns = %v, want %v", owed, walked)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestOwedRunsLongOutage(t *testing.T) {
+	spec := &dto.ScheduleSpec{Type: string(HMSTask), Interval: 1, Units: "seconds"}
+	lastRun := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := lastRun.Add(19*24*time.Hour + 500*time.Millisecond)
+	owed, err := OwedRuns(spec, FireOnce(), lastRun, now, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := lastRun.Add(19 * 24 * time.Hour)
+	if len(owed) != 1 || !owed[0].Equal(want) {
+		t.Fatalf("OwedRuns = %v, want [%v]", owed, want)
+	}
+}
+
+func TestOwedRunsPolicies(t *testing.T) {
+	spec := &dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"monday", "tuesday", "wednesday", "thursday", "friday"}, Times: []string{"09:00"}}
+	day := func(d int) time.Time {
+		return time.Date(2026, time.March, d, 9, 0, 0, 0, time.UTC)
+	}
+	//missed runs on the 3rd, 4th, 5th & 6th
+	lastRun := day(2)
+	now := day(6).Add(2 * time.Hour)
+	tests := []struct {
+		name   string
+		policy dto.MisfirePolicy
+		want   []time.Time
+	}{
+		{"skip", Skip(), nil},
+		{"fire once", FireOnce(), []time.Time{day(6)}},
+		{"unset fires once", dto.MisfirePolicy{}, []time.Time{day(6)}},
+		{"fire all", FireAll(10), []time.Time{day(3), day(4), day(5), day(6)}},
+		{"fire all most recent", FireAll(2), []time.Time{day(5), day(6)}},
+		{"fire if within", FireIfWithin(3 * time.Hour), []time.Time{day(6)}},
+		{"fire if within too old", FireIfWithin(time.Hour), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owed, err := OwedRuns(spec, tt.policy, lastRun, now, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(owed) != fmt.Sprint(tt.want) {
+				t.Errorf("OwedRuns = %v, want %v", owed, tt.want)
+			}
+		})
+	}
+	if owed, err := OwedRuns(spec, FireAll(10), day(6), now, time.UTC); err != nil || len(owed) != 0 {
+		t.Fatalf("OwedRuns without missed runs = %v, %v", owed, err)
+	}
+}
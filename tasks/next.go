@@ -0,0 +1,471 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+	"github.com/aodr3w/keiji-core/utils"
+)
+
+// ErrNoNextRun is returned by NextRun when a schedule has no further runs e.g a Once task that already ran
+var ErrNoNextRun = errors.New("schedule has no further runs")
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+var monthsByName = map[string]time.Month{
+	"january":   time.January,
+	"february":  time.February,
+	"march":     time.March,
+	"april":     time.April,
+	"may":       time.May,
+	"june":      time.June,
+	"july":      time.July,
+	"august":    time.August,
+	"september": time.September,
+	"october":   time.October,
+	"november":  time.November,
+	"december":  time.December,
+}
+
+/*
+NextRun returns the first execution time strictly after `after` for the
+provided schedule spec (as stored in TaskModel.ScheduleInfo).
+
+Wall clock schedules (DayTime, Monthly, Yearly & Cron) are evaluated in the
+schedule's own TimeZone when set, otherwise in loc; when loc is nil the
+workspace TIME_ZONE is used. Around DST transitions DayTime,
+Monthly & Yearly tasks run once: a wall clock time that does not exist (spring
+forward) is shifted forward by the length of the gap and a wall clock time that
+occurs twice (fall back) runs on its first occurrence. Cron tasks follow cron
+semantics: skipped times do not run and repeated times run on each occurrence.
+
+Runs on dates excluded by the schedule (SkipCalendars & BusinessDays) are
+skipped; every calendar referenced by the spec must be provided in calendars.
+Runs before StartAt or within a blackout period are skipped too and runs at
+or after EndAt return ErrNoNextRun. Interval (HMS) tasks resume at midnight
+after an excluded date, at StartAt and at the end of a blackout.
+*/
+func NextRun(spec *dto.ScheduleSpec, after time.Time, loc *time.Location, calendars ...*dto.Calendar) (time.Time, error) {
+	loc, err := scheduleLocation(spec, loc)
+	if err != nil {
+		return time.Time{}, err
+	}
+	excluded, err := exclusions(spec, calendars)
+	if err != nil {
+		return time.Time{}, err
+	}
+	after = after.In(loc)
+	interval := TaskType(spec.Type) == HMSTask
+	//resume is the run time of an interval task moved out of an excluded period
+	var resume *time.Time
+	//bounded so a calendar excluding every date cannot loop forever
+	for i := 0; i < maxExcludedDays; i++ {
+		var next time.Time
+		if resume != nil {
+			next, resume = *resume, nil
+		} else if next, err = nextRun(spec, after, loc); err != nil {
+			return time.Time{}, err
+		}
+		if spec.EndAt != nil && !next.Before(*spec.EndAt) {
+			return time.Time{}, ErrNoNextRun
+		}
+		if allowed, skipped := windowed(spec, next); skipped {
+			allowed = allowed.In(loc)
+			if interval {
+				resume = &allowed
+			} else {
+				after = allowed.Add(-time.Nanosecond)
+			}
+			continue
+		}
+		if !excluded(next) {
+			return next, nil
+		}
+		//move past the excluded date
+		midnight := time.Date(next.Year(), next.Month(), next.Day()+1, 0, 0, 0, 0, loc)
+		if interval {
+			resume = &midnight
+		} else {
+			after = midnight.Add(-time.Nanosecond)
+		}
+	}
+	return time.Time{}, fmt.Errorf("no run time outside excluded dates within %d days", maxExcludedDays)
+}
+
+// scheduleLocation returns the location the spec is evaluated in, see NextRun
+func scheduleLocation(spec *dto.ScheduleSpec, loc *time.Location) (*time.Location, error) {
+	taskLoc, err := spec.Location()
+	if err != nil {
+		return nil, err
+	}
+	if taskLoc != nil {
+		return taskLoc, nil
+	}
+	if loc == nil {
+		return utils.GetTimeZone()
+	}
+	return loc, nil
+}
+
+// maxExcludedDays is the number of consecutive excluded run dates NextRun skips before giving up
+const maxExcludedDays = 3660
+
+/*
+windowed returns the earliest time runs are allowed again when t falls before
+the spec's StartAt or within one of its blackouts, skipped being false otherwise
+*/
+func windowed(spec *dto.ScheduleSpec, t time.Time) (allowed time.Time, skipped bool) {
+	if spec.StartAt != nil && t.Before(*spec.StartAt) {
+		return *spec.StartAt, true
+	}
+	for _, b := range spec.Blackouts {
+		if b.Contains(t) {
+			return b.End, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// exclusions returns a function reporting wether a run time falls on a date excluded by the spec
+func exclusions(spec *dto.ScheduleSpec, calendars []*dto.Calendar) (func(time.Time) bool, error) {
+	skip := make([]*dto.Calendar, 0, len(spec.SkipCalendars))
+	for _, name := range spec.SkipCalendars {
+		var found *dto.Calendar
+		for _, cal := range calendars {
+			if cal != nil && cal.Name == name {
+				found = cal
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("calendar %v is not loaded", name)
+		}
+		skip = append(skip, found)
+	}
+	return func(t time.Time) bool {
+		if spec.BusinessDays && (t.Weekday() == time.Saturday || t.Weekday() == time.Sunday) {
+			return true
+		}
+		for _, cal := range skip {
+			if cal.Contains(t) {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+func nextRun(spec *dto.ScheduleSpec, after time.Time, loc *time.Location) (time.Time, error) {
+	switch TaskType(spec.Type) {
+	case CronTask:
+		cs, err := parseCron(spec.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cs.next(after)
+	case HMSTask:
+		d, err := intervalDuration(spec)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return after.Add(d), nil
+	case DayTimeTask:
+		return nextDayTime(spec, after, loc)
+	case MonthlyTask, YearlyTask:
+		return nextMonthDay(spec, after, loc)
+	case OnceTask:
+		if spec.RunAt == nil {
+			return time.Time{}, fmt.Errorf("once schedule has no run time")
+		}
+		if !spec.RunAt.After(after) {
+			return time.Time{}, ErrNoNextRun
+		}
+		return spec.RunAt.In(loc), nil
+	case DependentTask:
+		//runs are triggered by upstream tasks, see db.Repo.DownstreamRunnable
+		return time.Time{}, ErrNoNextRun
+	case EventTask:
+		//runs are triggered by published events, see db.Repo.GetSubscribers
+		return time.Time{}, ErrNoNextRun
+	case FileWatchTask:
+		//runs are triggered by file changes, see watch.Watcher
+		return time.Time{}, ErrNoNextRun
+	}
+	return time.Time{}, fmt.Errorf("unsupported schedule type: %v", spec.Type)
+}
+
+/*
+Upcoming returns the next n execution times after `after`, see NextRun.
+Fewer than n times are returned when the schedule runs out e.g a Once task.
+*/
+func Upcoming(spec *dto.ScheduleSpec, after time.Time, loc *time.Location, n int, calendars ...*dto.Calendar) ([]time.Time, error) {
+	runs := make([]time.Time, 0, n)
+	for i := 0; i < n; i++ {
+		next, err := NextRun(spec, after, loc, calendars...)
+		if errors.Is(err, ErrNoNextRun) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, next)
+		after = next
+	}
+	return runs, nil
+}
+
+func intervalDuration(spec *dto.ScheduleSpec) (time.Duration, error) {
+	n := spec.Interval
+	if n <= 0 {
+		return 0, fmt.Errorf("interval should be a positive number, got %d", n)
+	}
+	var unit time.Duration
+	switch spec.Units {
+	case "seconds":
+		unit = time.Second
+	case "minutes":
+		unit = time.Minute
+	case "hours":
+		unit = time.Hour
+	default:
+		return 0, fmt.Errorf("unsupported interval units: %v", spec.Units)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+func nextDayTime(spec *dto.ScheduleSpec, after time.Time, loc *time.Location) (time.Time, error) {
+	var days [7]bool
+	for _, d := range spec.Days {
+		day, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid day: %v", d)
+		}
+		days[day] = true
+	}
+	times, err := parseTimes(spec.Times)
+	if err != nil {
+		return time.Time{}, err
+	}
+	//check the remainder of this week plus the same weekday next week
+	for i := 0; i <= 7; i++ {
+		for _, at := range times {
+			candidate := wallClock(after.Year(), after.Month(), after.Day()+i, at.Hour(), at.Minute(), loc)
+			if days[candidate.Weekday()] && candidate.After(after) {
+				return candidate, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to compute next run for %v", spec.String())
+}
+
+func nextMonthDay(spec *dto.ScheduleSpec, after time.Time, loc *time.Location) (time.Time, error) {
+	var months [13]bool
+	for _, m := range spec.Months {
+		month, ok := monthsByName[strings.ToLower(m)]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid month: %v", m)
+		}
+		months[month] = true
+	}
+	if len(spec.Months) == 0 {
+		for i := range months {
+			months[i] = true
+		}
+	}
+	var weekday time.Weekday
+	if spec.Nth != 0 {
+		day, ok := weekdays[strings.ToLower(spec.Weekday)]
+		if !ok {
+			return time.Time{}, fmt.Errorf("invalid weekday: %v", spec.Weekday)
+		}
+		weekday = day
+	} else if !spec.LastDay && (spec.MonthDay < 1 || spec.MonthDay > 31) {
+		return time.Time{}, fmt.Errorf("invalid day of month: %v", spec.MonthDay)
+	}
+	times, err := parseTimes(spec.Times)
+	if err != nil {
+		return time.Time{}, err
+	}
+	//the calendar repeats every 28 years, which covers rare days e.g a 5th Friday in February
+	for i := 0; i < 12*28; i++ {
+		first := time.Date(after.Year(), after.Month()+time.Month(i), 1, 0, 0, 0, 0, loc)
+		if !months[first.Month()] {
+			continue
+		}
+		var day int
+		switch {
+		case spec.LastDay:
+			day = daysIn(first.Year(), first.Month())
+		case spec.Nth != 0:
+			day = nthWeekday(first.Year(), first.Month(), spec.Nth, weekday)
+			if day == 0 {
+				continue
+			}
+		default:
+			day = min(spec.MonthDay, daysIn(first.Year(), first.Month()))
+		}
+		for _, at := range times {
+			candidate := wallClock(first.Year(), first.Month(), day, at.Hour(), at.Minute(), loc)
+			if candidate.After(after) {
+				return candidate, nil
+			}
+		}
+	}
+	return time.Time{}, fmt.Errorf("failed to compute next run for %v", spec.String())
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+// nthWeekday returns the day of the month of the nth weekday, or 0 if the month
+// has no such day. n = -1 returns the last occurrence.
+func nthWeekday(year int, month time.Month, n int, weekday time.Weekday) int {
+	last := daysIn(year, month)
+	if n == -1 {
+		lastWeekday := time.Date(year, month, last, 0, 0, 0, 0, time.UTC).Weekday()
+		return last - (int(lastWeekday)-int(weekday)+7)%7
+	}
+	firstWeekday := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC).Weekday()
+	day := 1 + (int(weekday)-int(firstWeekday)+7)%7 + (n-1)*7
+	if day > last {
+		return 0
+	}
+	return day
+}
+
+// parseTimes parses times of day, returning them in the order they occur during the day
+func parseTimes(values []string) ([]time.Time, error) {
+	if len(values) == 0 {
+		return nil, fmt.Errorf("schedule has no times")
+	}
+	times := make([]time.Time, 0, len(values))
+	for _, t := range values {
+		at, err := utils.ParseTimeStr(t)
+		if err != nil {
+			return nil, err
+		}
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	return times, nil
+}
+
+// wallClock returns the first instant at which the wall clock in loc reads
+// y-m-d hh:mm. When that wall clock time is skipped by a DST transition the
+// time is shifted forward by the length of the gap.
+func wallClock(y int, m time.Month, d, hh, mm int, loc *time.Location) time.Time {
+	t := time.Date(y, m, d, hh, mm, 0, 0, loc)
+	wall := time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+	//offsets in effect before & after any transition near t
+	_, before := t.Add(-12 * time.Hour).Zone()
+	_, after := t.Add(12 * time.Hour).Zone()
+	first := wall.Add(-time.Duration(before) * time.Second).In(loc)
+	second := wall.Add(-time.Duration(after) * time.Second).In(loc)
+	if sameWallClock(first, wall) && sameWallClock(second, wall) {
+		if second.Before(first) {
+			return second
+		}
+		return first
+	}
+	if sameWallClock(first, wall) {
+		return first
+	}
+	if sameWallClock(second, wall) {
+		return second
+	}
+	//wall clock time falls in a gap
+	return first
+}
+
+func sameWallClock(t time.Time, wall time.Time) bool {
+	return t.Year() == wall.Year() && t.YearDay() == wall.YearDay() && t.Hour() == wall.Hour() && t.Minute() == wall.Minute()
+}
+
+// next returns the first time matching the cron schedule strictly after t.
+func (cs *cronSchedule) next(t time.Time) (time.Time, error) {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	added := false
+	yearLimit := t.Year() + 5
+
+WRAP:
+	if t.Year() > yearLimit {
+		return time.Time{}, fmt.Errorf("cron schedule has no run time within 5 years")
+	}
+
+	for cs.month&(1<<uint(t.Month())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 1, 0)
+		if t.Month() == time.January {
+			goto WRAP
+		}
+	}
+
+	for !cs.dayMatches(t) {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		t = t.AddDate(0, 0, 1)
+		//midnight may not exist on DST transition days
+		if t.Hour() != 0 {
+			if t.Hour() > 12 {
+				t = t.Add(time.Duration(24-t.Hour()) * time.Hour)
+			} else {
+				t = t.Add(time.Duration(-t.Hour()) * time.Hour)
+			}
+		}
+		if t.Day() == 1 {
+			goto WRAP
+		}
+	}
+
+	for cs.hour&(1<<uint(t.Hour())) == 0 {
+		if !added {
+			added = true
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		t = t.Add(time.Hour)
+		if t.Hour() == 0 {
+			goto WRAP
+		}
+	}
+
+	for cs.minute&(1<<uint(t.Minute())) == 0 {
+		if !added {
+			added = true
+		}
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto WRAP
+		}
+	}
+	return t, nil
+}
+
+// dayMatches follows cron semantics: when both day fields are restricted
+// a day matches if either field matches.
+func (cs *cronSchedule) dayMatches(t time.Time) bool {
+	domMatch := cs.dom&(1<<uint(t.Day())) != 0
+	dowMatch := cs.dow&(1<<uint(t.Weekday())) != 0
+	if cs.domStar || cs.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
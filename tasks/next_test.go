@@ -0,0 +1,338 @@
+package tasks
+
+import (
+	"errors"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return loc
+}
+
+func TestNextRun(t *testing.T) {
+	ny := mustLoadLocation(t, "America/New_York")
+	at := func(y int, m time.Month, d, hh, mm int) time.Time {
+		return time.Date(y, m, d, hh, mm, 0, 0, ny)
+	}
+	utc := func(y int, m time.Month, d, hh, mm int) time.Time {
+		return time.Date(y, m, d, hh, mm, 0, 0, time.UTC)
+	}
+	runAt := at(2026, time.June, 1, 12, 0)
+	tests := []struct {
+		name  string
+		spec  dto.ScheduleSpec
+		after time.Time
+		want  time.Time
+	}{
+		{
+			name:  "hms",
+			spec:  dto.ScheduleSpec{Type: string(HMSTask), Interval: 90, Units: "minutes"},
+			after: at(2026, time.March, 2, 10, 0),
+			want:  at(2026, time.March, 2, 11, 30),
+		},
+		{
+			name:  "hms across spring forward keeps elapsed time",
+			spec:  dto.ScheduleSpec{Type: string(HMSTask), Interval: 1, Units: "hours"},
+			after: at(2026, time.March, 8, 1, 30),
+			want:  at(2026, time.March, 8, 3, 30),
+		},
+		{
+			name:  "daytime later this week",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"monday", "thursday"}, Times: []string{"09:00"}},
+			after: at(2026, time.March, 2, 10, 0),
+			want:  at(2026, time.March, 5, 9, 0),
+		},
+		{
+			name:  "daytime same weekday next week",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"monday"}, Times: []string{"09:00"}},
+			after: at(2026, time.March, 2, 10, 0),
+			want:  at(2026, time.March, 9, 9, 0),
+		},
+		{
+			name:  "daytime later time the same day",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"monday"}, Times: []string{"06:00PM", "09:00"}},
+			after: at(2026, time.March, 2, 10, 0),
+			want:  at(2026, time.March, 2, 18, 0),
+		},
+		{
+			name:  "daytime in the spring forward gap is shifted by the gap",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"sunday"}, Times: []string{"02:30"}},
+			after: at(2026, time.March, 7, 0, 0),
+			want:  at(2026, time.March, 8, 3, 30),
+		},
+		{
+			name:  "daytime on fall back runs on the first occurrence",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"sunday"}, Times: []string{"01:30"}},
+			after: at(2026, time.October, 31, 0, 0),
+			want:  utc(2026, time.November, 1, 5, 30),
+		},
+		{
+			name:  "daytime on fall back runs once",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"sunday"}, Times: []string{"01:30"}},
+			after: utc(2026, time.November, 1, 5, 30),
+			want:  at(2026, time.November, 8, 1, 30),
+		},
+		{
+			name:  "daytime in the schedule's time zone",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: []string{"monday"}, Times: []string{"09:00"}, TimeZone: "Africa/Nairobi"},
+			after: utc(2026, time.March, 2, 0, 0),
+			want:  utc(2026, time.March, 2, 6, 0),
+		},
+		{
+			name:  "monthly day",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), MonthDay: 15, Times: []string{"08:00"}},
+			after: at(2026, time.March, 15, 8, 0),
+			want:  at(2026, time.April, 15, 8, 0),
+		},
+		{
+			name:  "monthly 31st runs on the 30th of a 30 day month",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), MonthDay: 31, Times: []string{"08:00"}},
+			after: at(2026, time.March, 31, 9, 0),
+			want:  at(2026, time.April, 30, 8, 0),
+		},
+		{
+			name:  "monthly 31st runs on the 28th of february",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), MonthDay: 31, Times: []string{"08:00"}},
+			after: at(2026, time.January, 31, 9, 0),
+			want:  at(2026, time.February, 28, 8, 0),
+		},
+		{
+			name:  "monthly 31st runs on the 31st again",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), MonthDay: 31, Times: []string{"08:00"}},
+			after: at(2026, time.April, 30, 9, 0),
+			want:  at(2026, time.May, 31, 8, 0),
+		},
+		{
+			name:  "monthly last day in a leap year",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), LastDay: true, Times: []string{"23:00"}},
+			after: at(2028, time.February, 1, 0, 0),
+			want:  at(2028, time.February, 29, 23, 0),
+		},
+		{
+			name:  "monthly 5th friday skips months without one",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), Nth: 5, Weekday: "friday", Times: []string{"17:00"}},
+			after: at(2026, time.January, 31, 0, 0),
+			want:  at(2026, time.May, 29, 17, 0),
+		},
+		{
+			name:  "monthly last monday",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), Nth: -1, Weekday: "monday", Times: []string{"09:00"}},
+			after: at(2026, time.March, 1, 0, 0),
+			want:  at(2026, time.March, 30, 9, 0),
+		},
+		{
+			name:  "yearly february 29th in a leap year",
+			spec:  dto.ScheduleSpec{Type: string(YearlyTask), Months: []string{"february"}, MonthDay: 29, Times: []string{"12:00"}},
+			after: at(2027, time.March, 1, 0, 0),
+			want:  at(2028, time.February, 29, 12, 0),
+		},
+		{
+			name:  "yearly february 29th runs on the 28th otherwise",
+			spec:  dto.ScheduleSpec{Type: string(YearlyTask), Months: []string{"february"}, MonthDay: 29, Times: []string{"12:00"}},
+			after: at(2026, time.January, 1, 0, 0),
+			want:  at(2026, time.February, 28, 12, 0),
+		},
+		{
+			name:  "yearly 5th sunday of february",
+			spec:  dto.ScheduleSpec{Type: string(YearlyTask), Months: []string{"february"}, Nth: 5, Weekday: "sunday", Times: []string{"12:00"}},
+			after: at(2026, time.January, 1, 0, 0),
+			want:  at(2032, time.February, 29, 12, 0),
+		},
+		{
+			name:  "monthly in the spring forward gap is shifted by the gap",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), MonthDay: 8, Times: []string{"02:15"}},
+			after: at(2026, time.March, 1, 0, 0),
+			want:  at(2026, time.March, 8, 3, 15),
+		},
+		{
+			name:  "once",
+			spec:  dto.ScheduleSpec{Type: string(OnceTask), RunAt: &runAt},
+			after: at(2026, time.May, 1, 0, 0),
+			want:  runAt,
+		},
+		{
+			name:  "cron weekdays",
+			spec:  dto.ScheduleSpec{Type: string(CronTask), Cron: "30 9 * * 1-5"},
+			after: at(2026, time.March, 6, 10, 0),
+			want:  at(2026, time.March, 9, 9, 30),
+		},
+		{
+			name:  "cron skips times in the spring forward gap",
+			spec:  dto.ScheduleSpec{Type: string(CronTask), Cron: "30 2 * * *"},
+			after: at(2026, time.March, 8, 0, 0),
+			want:  at(2026, time.March, 9, 2, 30),
+		},
+		{
+			name:  "cron runs the first fall back occurrence",
+			spec:  dto.ScheduleSpec{Type: string(CronTask), Cron: "30 1 * * *"},
+			after: at(2026, time.November, 1, 0, 0),
+			want:  utc(2026, time.November, 1, 5, 30),
+		},
+		{
+			name:  "cron runs the second fall back occurrence",
+			spec:  dto.ScheduleSpec{Type: string(CronTask), Cron: "30 1 * * *"},
+			after: utc(2026, time.November, 1, 5, 30),
+			want:  utc(2026, time.November, 1, 6, 30),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NextRun(&tt.spec, tt.after, ny)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("NextRun = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRunNoFurtherRuns(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 10, 0, 0, 0, time.UTC)
+	ran := now.Add(-time.Hour)
+	tests := []struct {
+		name string
+		spec dto.ScheduleSpec
+	}{
+		{"once that already ran", dto.ScheduleSpec{Type: string(OnceTask), RunAt: &ran}},
+		{"dependent", dto.ScheduleSpec{Type: string(DependentTask), After: []string{"upstream"}}},
+		{"event", dto.ScheduleSpec{Type: string(EventTask), Event: "orders.created"}},
+		{"file watch", dto.ScheduleSpec{Type: string(FileWatchTask), Glob: "/tmp/*.csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NextRun(&tt.spec, now, time.UTC)
+			if !errors.Is(err, ErrNoNextRun) {
+				t.Fatalf("NextRun error = %v, want ErrNoNextRun", err)
+			}
+		})
+	}
+}
+
+// checkUpcoming fails the test unless the runs of spec after `after` start with want
+func checkUpcoming(t *testing.T, spec *dto.ScheduleSpec, after time.Time, want []time.Time, calendars ...*dto.Calendar) {
+	t.Helper()
+	got, err := Upcoming(spec, after, time.UTC, len(want), calendars...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Upcoming = %v, want %v", got, want)
+	}
+	for i := range got {
+		if !got[i].Equal(want[i]) {
+			t.Fatalf("Upcoming = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestNextRunWindow(t *testing.T) {
+	day := func(d, hh, mm int) time.Time {
+		return time.Date(2026, time.March, d, hh, mm, 0, 0, time.UTC)
+	}
+	startAt := day(2, 14, 0)
+	endAt := day(2, 15, 0)
+	blackout := []dto.TimeRange{{Start: day(2, 9, 0), End: day(2, 12, 0)}}
+	daily := []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+	tests := []struct {
+		name  string
+		spec  dto.ScheduleSpec
+		after time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "daytime in a blackout is skipped",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: daily, Times: []string{"10:00", "13:00"}, Blackouts: blackout},
+			after: day(2, 0, 0),
+			want:  []time.Time{day(2, 13, 0), day(3, 10, 0)},
+		},
+		{
+			name:  "interval resumes at the end of a blackout",
+			spec:  dto.ScheduleSpec{Type: string(HMSTask), Interval: 30, Units: "minutes", Blackouts: blackout},
+			after: day(2, 8, 15),
+			want:  []time.Time{day(2, 8, 45), day(2, 12, 0), day(2, 12, 30)},
+		},
+		{
+			name:  "interval runs between start and end",
+			spec:  dto.ScheduleSpec{Type: string(HMSTask), Interval: 20, Units: "minutes", StartAt: &startAt, EndAt: &endAt},
+			after: day(2, 10, 0),
+			want:  []time.Time{day(2, 14, 0), day(2, 14, 20), day(2, 14, 40)},
+		},
+		{
+			name:  "daytime before start",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: daily, Times: []string{"09:00"}, StartAt: &startAt},
+			after: day(1, 0, 0),
+			want:  []time.Time{day(3, 9, 0)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkUpcoming(t, &tt.spec, tt.after, tt.want)
+		})
+	}
+	spec := &dto.ScheduleSpec{Type: string(HMSTask), Interval: 20, Units: "minutes", StartAt: &startAt, EndAt: &endAt}
+	if _, err := NextRun(spec, day(2, 14, 40), time.UTC); !errors.Is(err, ErrNoNextRun) {
+		t.Fatalf("NextRun at the end of the window = %v, want ErrNoNextRun", err)
+	}
+}
+
+func TestNextRunExcludedDates(t *testing.T) {
+	day := func(d, hh, mm int) time.Time {
+		return time.Date(2026, time.March, d, hh, mm, 0, 0, time.UTC)
+	}
+	holidays, err := dto.NewCalendar("holidays", []string{"2026-03-03"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	daily := []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+	tests := []struct {
+		name  string
+		spec  dto.ScheduleSpec
+		after time.Time
+		want  []time.Time
+	}{
+		{
+			name:  "calendar date is skipped",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: daily, Times: []string{"09:00"}, SkipCalendars: []string{"holidays"}},
+			after: day(2, 10, 0),
+			want:  []time.Time{day(4, 9, 0)},
+		},
+		{
+			name:  "interval resumes at midnight after a calendar date",
+			spec:  dto.ScheduleSpec{Type: string(HMSTask), Interval: 7, Units: "hours", SkipCalendars: []string{"holidays"}},
+			after: day(2, 20, 0),
+			want:  []time.Time{day(4, 0, 0), day(4, 7, 0)},
+		},
+		{
+			name:  "business days skip the weekend",
+			spec:  dto.ScheduleSpec{Type: string(DayTimeTask), Days: daily, Times: []string{"09:00"}, BusinessDays: true},
+			after: day(6, 10, 0),
+			want:  []time.Time{day(9, 9, 0)},
+		},
+		{
+			name:  "business days & a calendar",
+			spec:  dto.ScheduleSpec{Type: string(MonthlyTask), MonthDay: 3, Times: []string{"09:00"}, BusinessDays: true, SkipCalendars: []string{"holidays"}},
+			after: day(1, 0, 0),
+			want:  []time.Time{time.Date(2026, time.April, 3, 9, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			checkUpcoming(t, &tt.spec, tt.after, tt.want, holidays)
+		})
+	}
+	spec := &dto.ScheduleSpec{Type: string(HMSTask), Interval: 1, Units: "hours", SkipCalendars: []string{"holidays"}}
+	if _, err := NextRun(spec, day(2, 0, 0), time.UTC); err == nil {
+		t.Fatal("NextRun succeeded without the calendar the spec references")
+	}
+}
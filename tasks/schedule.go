@@ -4,18 +4,25 @@ package tasks
 this file should not be modified
 */
 import (
+	"errors"
 	"fmt"
-	"log"
 	"os"
-	"strconv"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/aodr3w/keiji-core/calendars"
+	"github.com/aodr3w/keiji-core/common"
 	"github.com/aodr3w/keiji-core/db"
+	"github.com/aodr3w/keiji-core/dto"
 	"github.com/aodr3w/keiji-core/logging"
 	"github.com/aodr3w/keiji-core/paths"
+	"github.com/aodr3w/keiji-core/utils"
 	"github.com/google/uuid"
 	"github.com/joho/godotenv"
+	"gorm.io/gorm"
 )
 
 var (
@@ -28,45 +35,96 @@ capture scheduling info
 */
 type Schedule struct{}
 type RunnableTask struct{}
-type IntervalTask struct{ n int64 }
+type IntervalTask struct {
+	n    int64
+	errs []error
+}
 
 type TaskTime struct {
-	day string
+	taskType TaskType
+	days     []string
+	months   []string
+	monthDay int
+	lastDay  bool
+	nth      int
+	weekday  string
+	errs     []error
 }
 type TaskDay struct{}
+type TaskOnce struct{}
+type TaskMonth struct {
+	taskType TaskType
+	months   []string
+	errs     []error
+}
 
 type TaskType string
 
 const (
-	HMSTask     TaskType = "HMS"
-	DayTimeTask TaskType = "DayTime"
+	Forbid  = dto.ConcurrencyForbid
+	Allow   = dto.ConcurrencyAllow
+	Replace = dto.ConcurrencyReplace
+	Queue   = dto.ConcurrencyQueue
+)
+
+const (
+	HMSTask       TaskType = "HMS"
+	DayTimeTask   TaskType = "DayTime"
+	CronTask      TaskType = "Cron"
+	MonthlyTask   TaskType = "Monthly"
+	YearlyTask    TaskType = "Yearly"
+	OnceTask      TaskType = "Once"
+	DependentTask TaskType = "Dependent"
+	EventTask     TaskType = "Event"
+	FileWatchTask TaskType = "FileWatch"
 )
 
 type Action struct {
-	n          int64
-	unit       string
-	day        string
-	execTime   string
-	taskType   TaskType
-	executable string
+	n         int64
+	unit      string
+	days      []string
+	execTimes []string
+	months    []string
+	monthDay  int
+	lastDay   bool
+	nth       int
+	weekday   string
+	runAt     time.Time
+	//runAfter is set when runAt is runAfter after the time the schedule was built
+	runAfter     time.Duration
+	cron         string
+	after        []string
+	afterOn      dto.DependencyCondition
+	event        string
+	glob         string
+	fileEvent    dto.FileEvent
+	debounce     time.Duration
+	timeZone     string
+	startAt      *time.Time
+	endAt        *time.Time
+	blackouts    []dto.TimeRange
+	calendars    []string
+	businessDays bool
+	misfire      dto.MisfirePolicy
+	concurrency  dto.ConcurrencyPolicy
+	maxRuns      int
+	timeout      time.Duration
+	retry        *RetryPolicy
+	taskType     TaskType
+	executable   string
+	//validation errors collected while building the schedule
+	errs []error
 }
 type ScheduledTask struct {
 	*Action
 	Name         string
 	Description  string
-	scheduleInfo map[string]interface{}
+	scheduleInfo *dto.ScheduleSpec
 	schedule     string
 	Slug         string
 	*logging.Logger
 }
 
-func (p *RetryPolicy) Map() map[string]int64 {
-	return map[string]int64{
-		"tries":   p.tries,
-		"backoff": p.backoff,
-		"delay":   p.delay,
-	}
-}
 func NewSchedule() *Schedule {
 	return &Schedule{}
 }
@@ -77,8 +135,38 @@ func (st *ScheduledTask) Save() error {
 	if err != nil {
 		return err
 	}
+	for _, name := range st.calendars {
+		if err := calendars.Sync(repo, name); err != nil {
+			if !common.Is(err) {
+				return err
+			}
+			//not in the workspace, it may have been stored previously
+			if _, err := repo.GetCalendarByName(name); err != nil {
+				return common.NewInvalidScheduleError("calendar", name, "not found in the workspace calendars directory or the database")
+			}
+		}
+	}
+	if st.taskType == OnceTask {
+		if err := st.resolveRunAt(repo); err != nil {
+			return err
+		}
+	}
+	if slices.Contains(st.after, st.Name) {
+		return common.NewInvalidScheduleError("after", st.Name, "a task cannot run after itself")
+	}
+	//saving no upstream tasks removes dependencies the task had before
+	if err := repo.SetDependencies(st.Name, st.after, st.afterOn); err != nil {
+		return err
+	}
+	var events []string
+	if st.taskType == EventTask {
+		events = append(events, st.event)
+	}
+	if err := repo.SetSubscriptions(st.Name, events...); err != nil {
+		return err
+	}
 	task_obj := db.TaskModel{}
-	task_obj.ScheduleInfo = st.scheduleInfo
+	task_obj.ScheduleInfo = *st.scheduleInfo
 	task_obj.Name = st.Name
 	task_obj.Description = st.Description
 	task_obj.Type = db.TaskType(st.taskType)
@@ -87,78 +175,391 @@ func (st *ScheduledTask) Save() error {
 	task_obj.LogPath = st.LogsPath
 	task_obj.Schedule = st.schedule
 	task_obj.Executable = st.E()
+	task_obj.MisfirePolicy = st.misfire
+	task_obj.ConcurrencyPolicy = st.concurrency
+	task_obj.MaxConcurrent = st.maxRuns
+	task_obj.Timeout = st.timeout
+	if st.retry != nil {
+		task_obj.RetryPolicy = st.retry.Spec()
+	}
 	return repo.SaveTask(&task_obj)
 }
 
+/*
+resolveRunAt checks the run time of a Once task against the stored task, if any,
+see resolveRunAt
+*/
+func (st *ScheduledTask) resolveRunAt(repo *db.Repo) error {
+	existing, err := repo.GetTaskByName(st.Name)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	var stored *dto.ScheduleSpec
+	if existing != nil && TaskType(existing.ScheduleInfo.Type) == OnceTask {
+		stored = &existing.ScheduleInfo
+	}
+	if err := resolveRunAt(st.scheduleInfo, stored, time.Now()); err != nil {
+		return err
+	}
+	st.schedule = st.scheduleInfo.String()
+	return nil
+}
+
+/*
+resolveRunAt checks the run time of the Once schedule spec against the stored one, if any.
+A task scheduled with After(d) keeps the run time stored by the same After(d) so a
+rebuild does not reschedule it, a run time stored by At or a different d is replaced.
+A run time in the past is only accepted if it is unchanged.
+*/
+func resolveRunAt(spec *dto.ScheduleSpec, stored *dto.ScheduleSpec, now time.Time) error {
+	var storedAt *time.Time
+	if stored != nil {
+		storedAt = stored.RunAt
+	}
+	if spec.RunAfter > 0 && storedAt != nil && stored.RunAfter == spec.RunAfter {
+		runAt := *storedAt
+		spec.RunAt = &runAt
+	}
+	runAt := spec.RunAt
+	if !runAt.After(now) && (storedAt == nil || !storedAt.Equal(*runAt)) {
+		return common.NewInvalidScheduleError("runAt", runAt.Format(time.RFC3339), "should be in the future")
+	}
+	return nil
+}
+
 func (s *Schedule) Run() *RunnableTask {
 	return &RunnableTask{}
 }
 
+/*
+Cron schedules the task with a standard five field cron expression
+(minute hour day-of-month month day-of-week) e.g `30 9 * * 1-5`.
+The expression is validated when Build() is called.
+*/
+func (s *Schedule) Cron(expr string) *Action {
+	return &Action{
+		cron:     strings.TrimSpace(expr),
+		taskType: CronTask,
+	}
+}
+
 func (s *Schedule) On() *TaskDay {
 	return &TaskDay{}
 }
 
+// Every is used to schedule a task every day e.g NewSchedule().Every().Day().At("06:00")
+func (s *Schedule) Every() *TaskDay {
+	return &TaskDay{}
+}
+
 func (d *TaskDay) Monday() *TaskTime {
-	return &TaskTime{
-		day: "Monday",
-	}
+	return d.Days(time.Monday)
 }
 func (d *TaskDay) Tuesday() *TaskTime {
-	return &TaskTime{
-		day: "Tuesday",
-	}
+	return d.Days(time.Tuesday)
 }
 func (d *TaskDay) Wednesday() *TaskTime {
-	return &TaskTime{
-		day: "Wednesday",
-	}
+	return d.Days(time.Wednesday)
 }
 func (d *TaskDay) Thursday() *TaskTime {
-	return &TaskTime{
-		day: "Thursday",
-	}
+	return d.Days(time.Thursday)
 }
 func (d *TaskDay) Friday() *TaskTime {
-	return &TaskTime{
-		day: "Friday",
-	}
+	return d.Days(time.Friday)
 }
 func (d *TaskDay) Saturday() *TaskTime {
-	return &TaskTime{
-		day: "Saturday",
-	}
+	return d.Days(time.Saturday)
 }
 func (d *TaskDay) Sunday() *TaskTime {
-	return &TaskTime{
-		day: "Sunday",
+	return d.Days(time.Sunday)
+}
+
+/*
+After runs the task each time all of the upstream tasks succeed, i.e once
+each of them has succeeded since the task last ran. Tasks are referred to
+by name e.g NewSchedule().After("extract-orders", "extract-customers")
+*/
+func (s *Schedule) After(upstream ...string) *Action {
+	return dependent(upstream, dto.DependsOnSuccess)
+}
+
+/*
+AfterFailure runs the task each time any of the upstream tasks fails
+e.g NewSchedule().AfterFailure("load-orders")
+*/
+func (s *Schedule) AfterFailure(upstream ...string) *Action {
+	return dependent(upstream, dto.DependsOnFailure)
+}
+
+func dependent(upstream []string, condition dto.DependencyCondition) *Action {
+	a := &Action{
+		taskType: DependentTask,
+		afterOn:  condition,
+	}
+	if len(upstream) == 0 {
+		a.addError(common.NewInvalidScheduleError("after", upstream, "at least one upstream task is required"))
+	}
+	for _, name := range upstream {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			a.addError(common.NewInvalidScheduleError("after", name, "upstream task name is empty"))
+			continue
+		}
+		a.after = append(a.after, name)
 	}
+	slices.Sort(a.after)
+	a.after = slices.Compact(a.after)
+	return a
 }
 
-func (tt *TaskTime) At(t string) *Action {
-	var layout string
-	tail := string(t[len(t)-2:])
-	if strings.EqualFold(tail, "AM") || strings.EqualFold(tail, "PM") {
-		layout = "03:04PM"
-	} else {
-		layout = "15:04"
+/*
+OnEvent runs the task each time the event is published on the bus
+e.g NewSchedule().OnEvent("orders.imported"), see bus.BusClient.Publish
+*/
+func (s *Schedule) OnEvent(event string) *Action {
+	a := &Action{
+		event:    strings.TrimSpace(event),
+		taskType: EventTask,
 	}
-	if _, err := time.Parse(layout, t); err != nil {
-		panic(fmt.Sprintf("incorrect time value: %v  should be in format %v ", t, layout))
+	if len(a.event) == 0 || strings.ContainsAny(a.event, " \t\n") {
+		a.addError(common.NewInvalidScheduleError("event", event, "should be a non empty name without spaces"))
 	}
+	return a
+}
+
+/*
+OnFileChange runs the task each time a file matching glob is created, moved in or
+written to e.g NewSchedule().OnFileChange("/data/inbox/*.csv"). Only the last path
+element may contain wildcards, see filepath.Match. The task receives the path of
+the file, see TriggerPath.
+*/
+func (s *Schedule) OnFileChange(glob string) *Action {
+	return fileWatch(glob, dto.FileChanged)
+}
+
+/*
+OnFileCreated runs the task each time a file matching pattern is created in or
+moved into dir e.g NewSchedule().OnFileCreated("/data/inbox", "orders-*.csv").
+The task receives the path of the file, see TriggerPath.
+*/
+func (s *Schedule) OnFileCreated(dir string, pattern string) *Action {
+	return fileWatch(filepath.Join(dir, pattern), dto.FileCreated)
+}
+
+func fileWatch(glob string, event dto.FileEvent) *Action {
+	a := &Action{
+		glob:      filepath.Clean(glob),
+		fileEvent: event,
+		taskType:  FileWatchTask,
+	}
+	dir, pattern := filepath.Split(a.glob)
+	switch {
+	case !filepath.IsAbs(a.glob):
+		a.addError(common.NewInvalidScheduleError("glob", glob, "should be an absolute path"))
+	case strings.ContainsAny(dir, "*?[\\"):
+		a.addError(common.NewInvalidScheduleError("glob", glob, "only the last path element may contain wildcards"))
+	default:
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			a.addError(common.NewInvalidScheduleError("glob", glob, err.Error()))
+		}
+	}
+	return a
+}
+
+// Once schedules the task to run a single time
+func (s *Schedule) Once() *TaskOnce {
+	return &TaskOnce{}
+}
+
+/*
+At runs the task once at t e.g
+NewSchedule().Once().At(time.Date(2026, 11, 1, 3, 0, 0, 0, nairobi)).
+t should be in the future when the task is first saved, rebuilding the
+schedule later with the same t does not run the task again.
+*/
+func (o *TaskOnce) At(t time.Time) *Action {
 	return &Action{
-		day:      tt.day,
-		execTime: t,
-		taskType: DayTimeTask,
+		runAt:    t,
+		taskType: OnceTask,
 	}
 }
 
+/*
+After runs the task once, d after the task is first saved. Rebuilding the
+schedule later keeps the original run time, so the task does not run again.
+*/
+func (o *TaskOnce) After(d time.Duration) *Action {
+	a := &Action{
+		runAt:    time.Now().Add(d),
+		runAfter: d,
+		taskType: OnceTask,
+	}
+	if d <= 0 {
+		a.addError(common.NewInvalidScheduleError("after", d, "should be a positive duration"))
+	}
+	return a
+}
+
+/*
+Monthly schedules the task on a day of every month
+e.g NewSchedule().Monthly().OnDay(1).At("02:00")
+*/
+func (s *Schedule) Monthly() *TaskMonth {
+	return &TaskMonth{
+		taskType: MonthlyTask,
+	}
+}
+
+/*
+Yearly schedules the task on a day of the provided month every year
+e.g NewSchedule().Yearly(time.March).OnLastDay().At("23:00")
+*/
+func (s *Schedule) Yearly(month time.Month) *TaskMonth {
+	m := &TaskMonth{
+		taskType: YearlyTask,
+	}
+	if month < time.January || month > time.December {
+		m.errs = append(m.errs, common.NewInvalidScheduleError("month", int(month), "not a valid month"))
+	} else {
+		m.months = []string{month.String()}
+	}
+	return m
+}
+
+/*
+OnDay schedules the task on day d (1-31) of the month. In months shorter
+than d the task runs on the last day of the month instead e.g OnDay(31)
+runs on the 30th of April and the 28th (or 29th) of February.
+*/
+func (m *TaskMonth) OnDay(d int) *TaskTime {
+	tt := m.taskTime()
+	tt.monthDay = d
+	if d < 1 || d > 31 {
+		tt.errs = append(tt.errs, common.NewInvalidScheduleError("monthDay", d, "should be between 1 and 31"))
+	}
+	return tt
+}
+
+// OnLastDay schedules the task on the last day of the month
+func (m *TaskMonth) OnLastDay() *TaskTime {
+	tt := m.taskTime()
+	tt.lastDay = true
+	return tt
+}
+
+/*
+OnNth schedules the task on the nth occurrence of day in the month e.g
+OnNth(2, time.Tuesday) for the second Tuesday. n may be 1-5, or -1 for the last
+occurrence. Months without a 5th occurrence of day are skipped.
+*/
+func (m *TaskMonth) OnNth(n int, day time.Weekday) *TaskTime {
+	tt := m.taskTime()
+	tt.nth = n
+	if n == 0 || n < -1 || n > 5 {
+		tt.errs = append(tt.errs, common.NewInvalidScheduleError("nth", n, "should be between 1 and 5, or -1 for the last occurrence"))
+	}
+	if day < time.Sunday || day > time.Saturday {
+		tt.errs = append(tt.errs, common.NewInvalidScheduleError("weekday", int(day), "not a valid weekday"))
+	} else {
+		tt.weekday = day.String()
+	}
+	return tt
+}
+
+func (m *TaskMonth) taskTime() *TaskTime {
+	return &TaskTime{
+		taskType: m.taskType,
+		months:   m.months,
+		errs:     m.errs,
+	}
+}
+
+// Weekdays schedules the task from Monday to Friday
+func (d *TaskDay) Weekdays() *TaskTime {
+	return d.Days(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday)
+}
+
+// Weekends schedules the task on Saturday and Sunday
+func (d *TaskDay) Weekends() *TaskTime {
+	return d.Days(time.Saturday, time.Sunday)
+}
+
+// Day schedules the task on every day of the week e.g NewSchedule().Every().Day().At("06:00")
+func (d *TaskDay) Day() *TaskTime {
+	return d.Days(time.Sunday, time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday)
+}
+
+// Days schedules the task on each of the provided days
+func (d *TaskDay) Days(days ...time.Weekday) *TaskTime {
+	tt := &TaskTime{}
+	if len(days) == 0 {
+		tt.errs = append(tt.errs, common.NewInvalidScheduleError("days", "", "at least one day is required"))
+	}
+	//store days in week order without duplicates
+	var set [7]bool
+	for _, day := range days {
+		if day < time.Sunday || day > time.Saturday {
+			tt.errs = append(tt.errs, common.NewInvalidScheduleError("days", int(day), "not a valid weekday"))
+			continue
+		}
+		set[day] = true
+	}
+	for i, ok := range set {
+		if ok {
+			tt.days = append(tt.days, time.Weekday(i).String())
+		}
+	}
+	return tt
+}
+
+/*
+At sets the time(s) of day at which the task runs, in format 15:04 or 03:04PM
+e.g NewSchedule().On().Weekdays().At("09:00", "05:00PM")
+*/
+func (tt *TaskTime) At(times ...string) *Action {
+	a := &Action{
+		days:     tt.days,
+		months:   tt.months,
+		monthDay: tt.monthDay,
+		lastDay:  tt.lastDay,
+		nth:      tt.nth,
+		weekday:  tt.weekday,
+		taskType: tt.taskType,
+		errs:     tt.errs,
+	}
+	if len(a.taskType) == 0 {
+		a.taskType = DayTimeTask
+	}
+	if len(times) == 0 {
+		a.addError(common.NewInvalidScheduleError("time", "", "at least one time is required"))
+	}
+	parsed := make(map[string]time.Time)
+	for _, t := range times {
+		pt, err := utils.ParseTimeStr(t)
+		if err != nil {
+			a.addError(common.NewInvalidScheduleError("time", t, "should be in format 15:04 or 03:04PM"))
+			continue
+		}
+		if _, ok := parsed[t]; !ok {
+			parsed[t] = pt
+			a.execTimes = append(a.execTimes, t)
+		}
+	}
+	//store times in the order they occur during the day
+	sort.SliceStable(a.execTimes, func(i, j int) bool {
+		return parsed[a.execTimes[i]].Before(parsed[a.execTimes[j]])
+	})
+	return a
+}
+
 func (s *RunnableTask) Every(n int64) *IntervalTask {
-	if n <= 0 {
-		log.Fatal("n should be a non negative number")
+	it := &IntervalTask{
+		n: n,
 	}
-	return &IntervalTask{
-		n,
+	if n <= 0 {
+		it.errs = append(it.errs, common.NewInvalidScheduleError("interval", n, "should be a positive number"))
 	}
+	return it
 }
 
 func (d *IntervalTask) Seconds() *Action {
@@ -166,6 +567,7 @@ func (d *IntervalTask) Seconds() *Action {
 		n:        d.n,
 		unit:     "seconds",
 		taskType: HMSTask,
+		errs:     d.errs,
 	}
 }
 
@@ -174,6 +576,7 @@ func (d *IntervalTask) Minutes() *Action {
 		n:        d.n,
 		unit:     "minutes",
 		taskType: HMSTask,
+		errs:     d.errs,
 	}
 }
 
@@ -182,52 +585,249 @@ func (d *IntervalTask) Hours() *Action {
 		n:        d.n,
 		unit:     "hours",
 		taskType: HMSTask,
+		errs:     d.errs,
 	}
 }
 
+/*
+In sets the time zone in which the task's schedule is evaluated e.g
+NewSchedule().Every().Day().At("09:00").In("America/New_York").
+The workspace TIME_ZONE is used when In is not called.
+*/
+func (a *Action) In(timeZone string) *Action {
+	a.timeZone = timeZone
+	return a
+}
+
+// StartingAt skips the task's runs before t, interval tasks first run at t
+func (a *Action) StartingAt(t time.Time) *Action {
+	a.startAt = &t
+	return a
+}
+
+// Until skips the task's runs at or after t, the task has no further runs once t is reached
+func (a *Action) Until(t time.Time) *Action {
+	a.endAt = &t
+	return a
+}
+
+/*
+Except skips runs that fall within any of the provided blackout periods e.g
+.Except(tasks.Between(freezeStart, freezeEnd)). Interval tasks resume at the
+end of the blackout.
+*/
+func (a *Action) Except(ranges ...dto.TimeRange) *Action {
+	for _, r := range ranges {
+		if !r.End.After(r.Start) {
+			a.addError(common.NewInvalidScheduleError("except", fmt.Sprintf("%v - %v", r.Start.Format(time.RFC3339), r.End.Format(time.RFC3339)), "end should be after start"))
+			continue
+		}
+		a.blackouts = append(a.blackouts, r)
+	}
+	return a
+}
+
+/*
+SkipCalendar skips runs on the dates of the named calendar. The calendar is loaded
+from the workspace calendars directory (<name>.ics or a <name>.txt date list)
+when the task is built, or must already be stored in the database.
+*/
+func (a *Action) SkipCalendar(name string) *Action {
+	if len(strings.TrimSpace(name)) == 0 {
+		a.addError(common.NewInvalidScheduleError("calendar", name, "calendar name is required"))
+		return a
+	}
+	a.calendars = append(a.calendars, name)
+	return a
+}
+
+// OnBusinessDays skips runs on Saturdays and Sundays, as well as the dates of any skipped calendar
+func (a *Action) OnBusinessDays() *Action {
+	a.businessDays = true
+	return a
+}
+
+/*
+OnMisfire sets what happens to runs missed while the scheduler was down
+e.g .OnMisfire(tasks.FireAll(10)). Missed runs are fired once by default.
+*/
+func (a *Action) OnMisfire(policy dto.MisfirePolicy) *Action {
+	switch policy.Kind {
+	case dto.MisfireFireAll:
+		if policy.MaxCount <= 0 {
+			a.addError(common.NewInvalidScheduleError("misfire", policy.MaxCount, "max count should be a positive number"))
+		}
+	case dto.MisfireFireIfWithin:
+		if policy.Within <= 0 {
+			a.addError(common.NewInvalidScheduleError("misfire", policy.Within, "should be a positive duration"))
+		}
+	case dto.MisfireFireOnce, dto.MisfireSkip, "":
+	default:
+		a.addError(common.NewInvalidScheduleError("misfire", policy.Kind, "unknown misfire policy"))
+	}
+	a.misfire = policy
+	return a
+}
+
+/*
+ConcurrencyPolicy sets what happens when a run is due while a previous run is
+still executing e.g .ConcurrencyPolicy(tasks.Queue). Overlapping runs are
+forbidden by default.
+*/
+func (a *Action) ConcurrencyPolicy(policy dto.ConcurrencyPolicy) *Action {
+	switch policy {
+	case Forbid, Allow, Replace, Queue:
+		a.concurrency = policy
+	default:
+		a.addError(common.NewInvalidScheduleError("concurrencyPolicy", policy, "should be one of forbid, allow, replace or queue"))
+	}
+	return a
+}
+
+// MaxConcurrent caps the number of runs executing at the same time for the Allow & Queue policies
+func (a *Action) MaxConcurrent(n int) *Action {
+	if n <= 0 {
+		a.addError(common.NewInvalidScheduleError("maxConcurrent", n, "should be a positive number"))
+	}
+	a.maxRuns = n
+	return a
+}
+
+/*
+Timeout sets the maximum duration of a run e.g .Timeout(30*time.Minute).
+The task's function is cancelled through its context once d elapses.
+*/
+func (a *Action) Timeout(d time.Duration) *Action {
+	if d <= 0 {
+		a.addError(common.NewInvalidScheduleError("timeout", d, "should be a positive duration"))
+	}
+	a.timeout = d
+	return a
+}
+
+/*
+WithRetry runs the task up to tries times in total when it fails, waiting delay before
+the first retry and multiplying the wait by backoff after each retry
+e.g .WithRetry(3, 30*time.Second, 2)
+*/
+func (a *Action) WithRetry(tries int, delay time.Duration, backoff float64) *Action {
+	if tries < 1 {
+		a.addError(common.NewInvalidScheduleError("retry", tries, "tries should be a positive number"))
+	}
+	if delay < 0 {
+		a.addError(common.NewInvalidScheduleError("retry", delay, "delay should not be negative"))
+	}
+	a.retry = NewRetryPolicy(int64(tries), 0, 0).WithDelay(delay).WithBackoff(backoff)
+	return a
+}
+
+/*
+Debounce waits until a watched file has not changed for d before running the
+task, so a file that is still being written triggers a single run
+*/
+func (a *Action) Debounce(d time.Duration) *Action {
+	if a.taskType != FileWatchTask {
+		a.addError(common.NewInvalidScheduleError("debounce", d, "only applies to file watch tasks"))
+	}
+	if d < 0 {
+		a.addError(common.NewInvalidScheduleError("debounce", d, "should not be negative"))
+	}
+	a.debounce = d
+	return a
+}
+
+// Between returns the period [start, end) for use with Except
+func Between(start time.Time, end time.Time) dto.TimeRange {
+	return dto.TimeRange{
+		Start: start,
+		End:   end,
+	}
+}
+
+func (a *Action) addError(err error) {
+	a.errs = append(a.errs, err)
+}
+
+/*
+Validate returns the errors collected while building the schedule,
+joined into a single error. Each of them is an *common.InvalidScheduleError
+*/
+func (a *Action) Validate() error {
+	errs := a.errs
+	if a.taskType == CronTask {
+		cs, err := parseCron(a.cron)
+		if err == nil {
+			//rejects expressions that never match e.g `0 0 30 2 *`
+			_, err = cs.next(time.Now())
+		}
+		if err != nil {
+			errs = append(errs, common.NewInvalidScheduleError("cron", a.cron, err.Error()))
+		}
+	}
+	if a.startAt != nil && a.endAt != nil && !a.endAt.After(*a.startAt) {
+		errs = append(errs, common.NewInvalidScheduleError("until", a.endAt.Format(time.RFC3339), "should be after the start of the task's window"))
+	}
+	if a.maxRuns > 0 && a.concurrency != Allow && a.concurrency != Queue {
+		errs = append(errs, common.NewInvalidScheduleError("maxConcurrent", a.maxRuns, "only applies to the allow & queue concurrency policies"))
+	}
+	if len(a.timeZone) > 0 {
+		if _, err := time.LoadLocation(a.timeZone); err != nil {
+			errs = append(errs, common.NewInvalidScheduleError("timeZone", a.timeZone, "unknown time zone"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
 // Assembles ScheduleInformation into a ScheduleTask struct for its caller
 func (a *Action) Build() error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatal(err)
+		return fmt.Errorf("failed to load task .env file: %w", err)
 	}
 	TASK_NAME = os.Getenv("TASK_NAME")
 	TASK_DESCRIPTION = os.Getenv("TASK_DESCRIPTION")
 	name := TASK_NAME
 	description := TASK_DESCRIPTION
-	slug := strings.Join(strings.Split(strings.ToLower(name), " "), "-")
-	log, err := logging.NewFileLogger(fmt.Sprintf("%v/%v", paths.TASK_LOG_DIR(slug), slug))
+	slug := taskSlug(name)
+	log, err := newTaskLogger(slug)
 	if err != nil {
 		return err
 	}
-	var schedule []string
-	var scheduledTask *ScheduledTask
-	var scheduleInfo map[string]interface{}
-	if a.taskType == HMSTask {
-		scheduleInfo = getIntervalTaskSchedule(a)
-	} else if a.taskType == DayTimeTask {
-		scheduleInfo = getDayTimeTaskSchedule(a)
-	}
-	for k, v := range scheduleInfo {
-		switch value := v.(type) {
-		case int64:
-			schedule = append(schedule, fmt.Sprintf("%s:%s", k, strconv.Itoa(int(value))))
-		default:
-			schedule = append(schedule, fmt.Sprintf("%s:%s", k, value))
-		}
-	}
-	scheduledTask = &ScheduledTask{
+	scheduleInfo := a.Spec()
+	scheduledTask := &ScheduledTask{
 		a,
 		name,
 		description,
 		scheduleInfo,
-		strings.Join(schedule, ","),
+		scheduleInfo.String(),
 		slug,
 		log,
 	}
 	return NewTaskBuilder().Build(scheduledTask)
 }
 
+func taskSlug(name string) string {
+	return strings.Join(strings.Split(strings.ToLower(name), " "), "-")
+}
+
+func newTaskLogger(slug string) (*logging.Logger, error) {
+	return logging.NewFileLogger(fmt.Sprintf("%v/%v", paths.TASK_LOG_DIR(slug), slug))
+}
+
+/*
+NewTaskLogger returns the logger of the task defined in the
+task's .env file, writing to the same log as its schedule
+*/
+func NewTaskLogger() (*logging.Logger, error) {
+	if err := godotenv.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load task .env file: %w", err)
+	}
+	return newTaskLogger(taskSlug(os.Getenv("TASK_NAME")))
+}
+
 func (a *Action) E() string {
 	return a.executable
 }
@@ -240,20 +840,59 @@ func (a *Action) Unit() string {
 	return a.unit
 }
 
-func (a *Action) Type() TaskType {
-	return a.taskType
+func (a *Action) Cron() string {
+	return a.cron
 }
 
-func getIntervalTaskSchedule(a *Action) map[string]interface{} {
-	scheduleInfo := make(map[string]interface{})
-	scheduleInfo["units"] = a.unit
-	scheduleInfo["interval"] = a.n
-	return scheduleInfo
+func (a *Action) TimeZone() string {
+	return a.timeZone
 }
 
-func getDayTimeTaskSchedule(a *Action) map[string]interface{} {
-	scheduleInfo := make(map[string]interface{})
-	scheduleInfo["day"] = a.day
-	scheduleInfo["time"] = a.execTime
-	return scheduleInfo
+func (a *Action) Type() TaskType {
+	return a.taskType
+}
+
+// Spec returns the typed schedule information of the action
+func (a *Action) Spec() *dto.ScheduleSpec {
+	spec := &dto.ScheduleSpec{
+		Version:       dto.ScheduleSpecVersion,
+		Type:          string(a.taskType),
+		TimeZone:      a.timeZone,
+		SkipCalendars: a.calendars,
+		BusinessDays:  a.businessDays,
+		StartAt:       a.startAt,
+		EndAt:         a.endAt,
+		Blackouts:     a.blackouts,
+	}
+	switch a.taskType {
+	case HMSTask:
+		spec.Interval = a.n
+		spec.Units = a.unit
+	case DayTimeTask:
+		spec.Days = a.days
+		spec.Times = a.execTimes
+	case MonthlyTask, YearlyTask:
+		spec.Months = a.months
+		spec.MonthDay = a.monthDay
+		spec.LastDay = a.lastDay
+		spec.Nth = a.nth
+		spec.Weekday = a.weekday
+		spec.Times = a.execTimes
+	case OnceTask:
+		runAt := a.runAt.Truncate(time.Second)
+		spec.RunAt = &runAt
+		spec.RunAfter = a.runAfter
+	case CronTask:
+		spec.Cron = a.cron
+	case DependentTask:
+		spec.After = a.after
+		spec.AfterOn = a.afterOn
+	case EventTask:
+		spec.Event = a.event
+	case FileWatchTask:
+		spec.Glob = a.glob
+		spec.FileEvent = a.fileEvent
+		spec.Debounce = a.debounce
+	}
+	return spec
 }
@@ -0,0 +1,88 @@
+package tasks
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aodr3w/keiji-core/common"
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+func TestResolveRunAt(t *testing.T) {
+	now := time.Date(2026, time.March, 2, 9, 0, 0, 0, time.UTC)
+	hour := now.Add(time.Hour)
+	past := now.Add(-time.Hour)
+	once := func(runAt time.Time, after time.Duration) *dto.ScheduleSpec {
+		return &dto.ScheduleSpec{Version: dto.ScheduleSpecVersion, Type: string(OnceTask), RunAt: &runAt, RunAfter: after}
+	}
+	tests := []struct {
+		name    string
+		spec    *dto.ScheduleSpec
+		stored  *dto.ScheduleSpec
+		want    time.Time
+		invalid bool
+	}{
+		{"new At", once(hour, 0), nil, hour, false},
+		{"new At in the past", once(past, 0), nil, time.Time{}, true},
+		{"new After", once(hour, time.Hour), nil, hour, false},
+		{"After keeps the run time of the same After", once(now.Add(2*time.Hour), time.Hour), once(past, time.Hour), past, false},
+		{"After replaces the run time of a different After", once(now.Add(2*time.Hour), 2*time.Hour), once(past, time.Hour), now.Add(2 * time.Hour), false},
+		{"After replaces the run time of an At", once(hour, time.Hour), once(past, 0), hour, false},
+		{"At replaces the run time of an After", once(now.Add(2*time.Hour), 0), once(hour, time.Hour), now.Add(2 * time.Hour), false},
+		{"unchanged At in the past", once(past, 0), once(past, 0), past, false},
+		{"changed At in the past", once(past, 0), once(hour, 0), time.Time{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := resolveRunAt(tt.spec, tt.stored, now)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("resolveRunAt = nil, want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.spec.RunAt.Equal(tt.want) {
+				t.Errorf("runAt = %v, want %v", tt.spec.RunAt, tt.want)
+			}
+		})
+	}
+}
+
+func TestInvalidTime(t *testing.T) {
+	err := NewSchedule().On().Monday().At("5").Validate()
+	var invalid *common.InvalidScheduleError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Validate = %v, want a *common.InvalidScheduleError", err)
+	}
+	if invalid.Field != "time" || invalid.Value != "5" {
+		t.Errorf("error is for %v %q, want time \"5\"", invalid.Field, invalid.Value)
+	}
+}
+
+func TestBuilderErrorsAreJoined(t *testing.T) {
+	err := NewSchedule().On().Days(time.Weekday(9)).At("5", "25:00").In("Nowhere/City").Validate()
+	var invalid *common.InvalidScheduleError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Validate = %v, want a *common.InvalidScheduleError", err)
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Validate = %T, want the errors joined", err)
+	}
+	var fields []string
+	for _, err := range joined.Unwrap() {
+		if !errors.As(err, &invalid) {
+			t.Fatalf("error %v is not a *common.InvalidScheduleError", err)
+		}
+		fields = append(fields, fmt.Sprintf("%v:%v", invalid.Field, invalid.Value))
+	}
+	want := "[days:9 time:5 time:25:00 timeZone:Nowhere/City]"
+	if fmt.Sprint(fields) != want {
+		t.Errorf("errors = %v, want %v", fields, want)
+	}
+}
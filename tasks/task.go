@@ -1,29 +1,178 @@
 package tasks
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"math"
+	"math/rand/v2"
+	"runtime/debug"
 	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+	"github.com/aodr3w/keiji-core/logging"
+)
+
+type Jitter string
+
+const (
+	//NoJitter waits exactly the computed delay
+	NoJitter Jitter = ""
+	//FullJitter waits a random delay between 0 and the computed delay
+	FullJitter Jitter = "full"
+	//EqualJitter waits half the computed delay plus a random delay up to the other half
+	EqualJitter Jitter = "equal"
 )
 
+/*
+NewRetryPolicy returns a policy that runs a task up to tries times, waiting delay
+seconds before the first retry and multiplying the wait by backoff after each retry.
+Use the With* methods for sub-second delays, a maximum delay, jitter and
+retryable error classification.
+*/
 func NewRetryPolicy(tries int64, backoff int64, delay int64) *RetryPolicy {
 	return &RetryPolicy{
 		tries:   tries,
-		backoff: backoff,
-		delay:   delay,
+		backoff: float64(backoff),
+		delay:   time.Duration(delay) * time.Second,
 	}
 }
 
 type RetryPolicy struct {
-	tries   int64
-	backoff int64
-	delay   int64
+	tries    int64
+	backoff  float64
+	delay    time.Duration
+	maxDelay time.Duration
+	jitter   Jitter
+	retryIf  func(error) bool
+}
+
+// WithDelay sets the wait before the first retry
+func (p *RetryPolicy) WithDelay(d time.Duration) *RetryPolicy {
+	p.delay = d
+	return p
+}
+
+// WithBackoff sets the factor the wait is multiplied by after each retry, values below 1 keep the wait constant
+func (p *RetryPolicy) WithBackoff(backoff float64) *RetryPolicy {
+	p.backoff = backoff
+	return p
+}
+
+// WithMaxDelay caps the wait between retries, 0 for no cap
+func (p *RetryPolicy) WithMaxDelay(d time.Duration) *RetryPolicy {
+	p.maxDelay = d
+	return p
+}
+
+// WithJitter randomises the wait between retries
+func (p *RetryPolicy) WithJitter(jitter Jitter) *RetryPolicy {
+	p.jitter = jitter
+	return p
+}
+
+/*
+WithRetryIf only retries errors for which retryIf returns true.
+Errors wrapped with Permanent are never retried.
+*/
+func (p *RetryPolicy) WithRetryIf(retryIf func(error) bool) *RetryPolicy {
+	p.retryIf = retryIf
+	return p
+}
+
+/*
+Delay returns the wait before the nth retry (starting at 1)
+*/
+func (p *RetryPolicy) Delay(n int) time.Duration {
+	backoff := p.backoff
+	if backoff < 1 {
+		backoff = 1
+	}
+	d := float64(p.delay) * math.Pow(backoff, float64(n-1))
+	if p.maxDelay > 0 && d > float64(p.maxDelay) {
+		d = float64(p.maxDelay)
+	}
+	//guard against overflowing time.Duration, float64(math.MaxInt64) rounds up to 2^63
+	delay := time.Duration(math.MaxInt64)
+	if d < math.MaxInt64 {
+		delay = time.Duration(d)
+	}
+	if delay <= 0 {
+		return 0
+	}
+	switch p.jitter {
+	case FullJitter:
+		return rand.N(delay)
+	case EqualJitter:
+		return delay/2 + rand.N(delay/2+1)
+	}
+	return delay
+}
+
+/*
+Retryable returns true if err should be retried, i.e it is not
+a PermanentError and it satisfies the policy's RetryIf predicate
+*/
+func (p *RetryPolicy) Retryable(err error) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+	return p.retryIf == nil || p.retryIf(err)
+}
+
+// Map returns the policy in a form that can be shown to operators e.g through dto.TaskInfo
+func (p *RetryPolicy) Map() map[string]interface{} {
+	m := p.Spec().Map()
+	m["retryIf"] = p.retryIf != nil
+	return m
+}
+
+/*
+Spec returns the stored form of the policy. The RetryIf
+predicate cannot be stored and is not part of it.
+*/
+func (p *RetryPolicy) Spec() *dto.RetryPolicySpec {
+	return &dto.RetryPolicySpec{
+		Tries:    p.tries,
+		Delay:    p.delay,
+		Backoff:  p.backoff,
+		MaxDelay: p.maxDelay,
+		Jitter:   string(p.jitter),
+	}
+}
+
+/*
+RetryPolicyFromSpec returns the policy stored in spec e.g TaskModel.RetryPolicy,
+so a scheduler can compute the delay before re-running a failed task
+*/
+func RetryPolicyFromSpec(spec *dto.RetryPolicySpec) *RetryPolicy {
+	return &RetryPolicy{
+		tries:    spec.Tries,
+		backoff:  spec.Backoff,
+		delay:    spec.Delay,
+		maxDelay: spec.MaxDelay,
+		jitter:   Jitter(spec.Jitter),
+	}
 }
 
 type Task struct {
 	Policy *RetryPolicy
 	F      func() error
+	//FCtx is used instead of F when set, receiving the context passed to RunContext
+	FCtx func(ctx context.Context) error
+	//Timeout is the maximum duration of Run across all attempts, 0 for none
+	Timeout time.Duration
+	//Logger receives the stack trace of panics recovered from the task's function, if set
+	Logger *logging.Logger
+	//StopGrace is how long RunContext waits for the function to return once it is stopped,
+	//DefaultStopGrace when 0
+	StopGrace time.Duration
 }
 
+// DefaultStopGrace is the StopGrace of tasks that do not set one
+const DefaultStopGrace = 5 * time.Second
+
 func NewTask(f func() error, policy *RetryPolicy) *Task {
 	if f == nil {
 		panic("f cannot be nil, please provide task function `f` such a f() -> error")
@@ -34,26 +183,107 @@ func NewTask(f func() error, policy *RetryPolicy) *Task {
 	}
 }
 
+/*
+NewTaskCtx returns a task whose function receives a context that is cancelled
+when the task is stopped or times out, see RunContext
+*/
+func NewTaskCtx(f func(ctx context.Context) error, policy *RetryPolicy) *Task {
+	if f == nil {
+		panic("f cannot be nil, please provide task function `f` such a f(ctx) -> error")
+	}
+	return &Task{
+		Policy: policy,
+		FCtx:   f,
+	}
+}
+
 func (t *Task) Run() error {
+	return t.RunContext(context.Background())
+}
+
+/*
+RunContext runs the task, returning once it completes, ctx is done
+or the task's Timeout elapses, whichever comes first. The context
+is passed on to the task's function and aborts retry delays.
+Once stopped, RunContext waits up to StopGrace for the function to return.
+A function that ignores ctx, including every F set through NewTask, keeps
+running after RunContext returns if it does not finish within StopGrace.
+*/
+func (t *Task) RunContext(ctx context.Context) error {
+	if t.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, t.Timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- t.run(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+	}
+	err := ctx.Err()
+	if err == context.DeadlineExceeded && t.Timeout > 0 {
+		err = fmt.Errorf("task timed out after %v: %w", t.Timeout, err)
+	}
+	grace := t.StopGrace
+	if grace <= 0 {
+		grace = DefaultStopGrace
+	}
+	select {
+	case <-done:
+	case <-time.After(grace):
+		err = fmt.Errorf("%w, task still running after %v", err, grace)
+	}
+	return err
+}
+
+func (t *Task) run(ctx context.Context) error {
 	if t.Policy != nil {
-		tries := t.Policy.tries
-		delay := t.Policy.delay
-		backoff := t.Policy.backoff
+		tries := max(t.Policy.tries, 1)
 		var err error
-		for i := tries; i > 0; i-- {
-			err = t.F()
-			if err != nil {
-				if i > 1 {
-					fmt.Printf("An error occured: %v. Retrying in %d seconds...\n", err, delay)
-					time.Sleep(time.Second * time.Duration(delay))
-					delay *= backoff
-				}
-			} else {
+		for attempt := int64(1); attempt <= tries; attempt++ {
+			err = t.call(ctx)
+			if err == nil {
 				return nil
 			}
+			if !t.Policy.Retryable(err) {
+				return fmt.Errorf("task failed after %d attempts, not retrying: %w", attempt, err)
+			}
+			if attempt < tries {
+				delay := t.Policy.Delay(int(attempt))
+				fmt.Printf("An error occured: %v. Retrying in %v...\n", err, delay)
+				select {
+				case <-time.After(delay):
+				case <-ctx.Done():
+					return fmt.Errorf("task retries aborted: %w", ctx.Err())
+				}
+			}
 		}
 		return fmt.Errorf("task failed after %d attempts: %w", tries, err)
 	}
 
+	return t.call(ctx)
+}
+
+/*
+call runs the task's function once, recovering a panic into a *PanicError
+so it counts as a failed attempt instead of crashing the task
+*/
+func (t *Task) call(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicErr := &PanicError{Value: r, Stack: debug.Stack()}
+			if t.Logger != nil {
+				t.Logger.Error("%v", ErrorText(panicErr))
+			}
+			err = panicErr
+		}
+	}()
+	if t.FCtx != nil {
+		return t.FCtx(ctx)
+	}
 	return t.F()
 }
@@ -0,0 +1,178 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunRecoversPanics(t *testing.T) {
+	calls := 0
+	task := NewTask(func() error {
+		calls++
+		panic("boom")
+	}, NewRetryPolicy(2, 1, 0))
+	err := task.Run()
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Fatalf("Run = %v, want a *PanicError", err)
+	}
+	if calls != 2 {
+		t.Errorf("function called %d times, want a panic to count as an attempt", calls)
+	}
+	if panicErr.Value != "boom" || strings.Contains(panicErr.Error(), "\n") {
+		t.Errorf("PanicError.Error() = %q, want the panic value on one line", panicErr.Error())
+	}
+	text := ErrorText(err)
+	if !strings.HasPrefix(text, err.Error()) || !strings.Contains(text, "goroutine") || !strings.Contains(text, "task_test.go") {
+		t.Errorf("ErrorText does not include the stack:\n%v", text)
+	}
+}
+
+func TestErrorText(t *testing.T) {
+	if text := ErrorText(nil); text != "" {
+		t.Errorf("ErrorText(nil) = %q", text)
+	}
+	if text := ErrorText(errors.New("failed")); text != "failed" {
+		t.Errorf("ErrorText = %q, want the error's message", text)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	policy := func(backoff float64, maxDelay time.Duration, jitter Jitter) *RetryPolicy {
+		return NewRetryPolicy(5, 0, 0).WithDelay(time.Second).WithBackoff(backoff).WithMaxDelay(maxDelay).WithJitter(jitter)
+	}
+	tests := []struct {
+		name   string
+		policy *RetryPolicy
+		n      int
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"first retry", policy(2, 0, NoJitter), 1, time.Second, time.Second},
+		{"backoff", policy(2, 0, NoJitter), 3, 4 * time.Second, 4 * time.Second},
+		{"backoff below 1 keeps the delay", policy(0.5, 0, NoJitter), 3, time.Second, time.Second},
+		{"no backoff keeps the delay", policy(0, 0, NoJitter), 3, time.Second, time.Second},
+		{"capped by max delay", policy(2, 3*time.Second, NoJitter), 4, 3 * time.Second, 3 * time.Second},
+		{"capped without overflowing", policy(10, 0, NoJitter), 100, math.MaxInt64, math.MaxInt64},
+		{"full jitter", policy(2, 0, FullJitter), 3, 0, 4 * time.Second},
+		{"equal jitter", policy(2, 0, EqualJitter), 3, 2 * time.Second, 4 * time.Second},
+		{"jitter within the cap", policy(2, 3*time.Second, FullJitter), 4, 0, 3 * time.Second},
+		{"jitter without overflowing", policy(10, 0, FullJitter), 100, 0, math.MaxInt64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if d := tt.policy.Delay(tt.n); d < tt.min || d > tt.max {
+					t.Fatalf("Delay(%d) = %v, want between %v and %v", tt.n, d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestRunRetries(t *testing.T) {
+	failed := errors.New("failed")
+	skip := errors.New("skip")
+	retryIf := func(err error) bool { return !errors.Is(err, skip) }
+	tests := []struct {
+		name      string
+		policy    *RetryPolicy
+		errs      []error
+		wantCalls int
+		wantErr   error
+	}{
+		{"succeeds on a retry", NewRetryPolicy(3, 1, 0), []error{failed, nil}, 2, nil},
+		{"runs up to tries times", NewRetryPolicy(3, 1, 0), []error{failed, failed, failed, nil}, 3, failed},
+		{"permanent errors stop retries", NewRetryPolicy(3, 1, 0), []error{Permanent(failed), nil}, 1, failed},
+		{"retried when RetryIf is true", NewRetryPolicy(3, 1, 0).WithRetryIf(retryIf), []error{failed, nil}, 2, nil},
+		{"not retried when RetryIf is false", NewRetryPolicy(3, 1, 0).WithRetryIf(retryIf), []error{skip, nil}, 1, skip},
+		{"RetryIf does not override Permanent", NewRetryPolicy(3, 1, 0).WithRetryIf(retryIf), []error{Permanent(failed), nil}, 1, failed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			task := NewTask(func() error {
+				err := tt.errs[calls]
+				calls++
+				return err
+			}, tt.policy)
+			err := task.Run()
+			if calls != tt.wantCalls {
+				t.Errorf("function called %d times, want %d", calls, tt.wantCalls)
+			}
+			if tt.wantErr == nil && err != nil || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRetrySleepAbortsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	calls := 0
+	task := NewTask(func() error {
+		calls++
+		cancel()
+		return errors.New("failed")
+	}, NewRetryPolicy(3, 1, 0).WithDelay(time.Hour))
+	start := time.Now()
+	err := task.run(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("run = %v, want context.Canceled", err)
+	}
+	if calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("run called the function %d times in %v, want the retry sleep aborted", calls, time.Since(start))
+	}
+}
+
+func TestRunContextWaitsForTheFunction(t *testing.T) {
+	tests := []struct {
+		name     string
+		f        func(ctx context.Context, stop chan struct{}) error
+		returned bool
+	}{
+		{
+			name: "function stops with ctx",
+			f: func(ctx context.Context, stop chan struct{}) error {
+				<-ctx.Done()
+				time.Sleep(10 * time.Millisecond)
+				return ctx.Err()
+			},
+			returned: true,
+		},
+		{
+			name: "function ignores ctx",
+			f: func(ctx context.Context, stop chan struct{}) error {
+				<-stop
+				return nil
+			},
+			returned: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stop := make(chan struct{})
+			defer close(stop)
+			var returned atomic.Bool
+			task := NewTaskCtx(func(ctx context.Context) error {
+				defer returned.Store(true)
+				return tt.f(ctx, stop)
+			}, nil)
+			task.Timeout = 10 * time.Millisecond
+			task.StopGrace = 100 * time.Millisecond
+			err := task.Run()
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("Run = %v, want context.DeadlineExceeded", err)
+			}
+			if returned.Load() != tt.returned {
+				t.Errorf("function returned = %v when Run returned, want %v", returned.Load(), tt.returned)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/aodr3w/keiji-core/constants"
+)
+
+type triggerPathKey struct{}
+
+type paramsKey struct{}
+
+/*
+WithTriggerPath returns a copy of ctx carrying the path of the file that triggered the run
+*/
+func WithTriggerPath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, triggerPathKey{}, path)
+}
+
+/*
+TriggerPath returns the path of the file that triggered a FileWatch task's run, read
+from ctx or, when ctx does not carry one, the constants.TRIGGER_PATH_ENV environment
+variable set by the scheduler. It is empty for runs not triggered by a file.
+*/
+func TriggerPath(ctx context.Context) string {
+	if path, ok := ctx.Value(triggerPathKey{}).(string); ok {
+		return path
+	}
+	return os.Getenv(constants.TRIGGER_PATH_ENV)
+}
+
+/*
+Params holds the parameters of a run, passed to the task's executable as
+repeated --param key=value flags e.g by bus.BusClient.RunNow.
+It implements flag.Value, see the task's main.go.
+*/
+type Params map[string]string
+
+func (p Params) String() string {
+	pairs := make([]string, 0, len(p))
+	for key, value := range p {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// Set parses a key=value flag, the value may be empty or contain `=`
+func (p Params) Set(flag string) error {
+	key, value, ok := strings.Cut(flag, "=")
+	if !ok || len(key) == 0 {
+		return fmt.Errorf("invalid param %q, expected key=value", flag)
+	}
+	p[key] = value
+	return nil
+}
+
+/*
+WithParams returns a copy of ctx carrying the parameters of the run
+*/
+func WithParams(ctx context.Context, params Params) context.Context {
+	return context.WithValue(ctx, paramsKey{}, params)
+}
+
+/*
+RunParams returns the parameters of the run carried by ctx, empty
+for scheduled runs
+*/
+func RunParams(ctx context.Context) Params {
+	if params, ok := ctx.Value(paramsKey{}).(Params); ok {
+		return params
+	}
+	return Params{}
+}
@@ -1,8 +1,13 @@
 package main
 
-func Function() error {
+import "context"
+
+func Function(ctx context.Context) error {
 	/*
 		please put the logic you wish to execute in this function.
+		ctx is cancelled when the task is stopped or its timeout elapses.
+		tasks.TriggerPath(ctx) returns the file that triggered the run of a file watch task.
+		tasks.RunParams(ctx) returns the parameters of a manual run.
 	*/
 	return nil
 }
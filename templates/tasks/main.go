@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/aodr3w/keiji-core/tasks"
 )
 
 /*This file is generated. Modify catiously*/
@@ -12,15 +19,44 @@ func main() {
 	//use flags to choose between run-schedule and run-function
 	schedule := flag.Bool("schedule", false, "provide true to save task's schedule")
 	run := flag.Bool("run", false, "provide true to run task's function")
+	timeout := flag.Duration("timeout", 0, "maximum duration of the task's function e.g 30m, 0 for none")
+	params := tasks.Params{}
+	flag.Var(params, "param", "parameter passed to the task's function as key=value, may be repeated")
 	flag.Parse()
 	if *schedule {
 		err = Schedule()
 	} else if *run {
-		err = Function()
+		err = runFunction(*timeout, params)
 	} else {
 		err = fmt.Errorf("valid arguments: --schedule, --run")
 	}
 	if err != nil {
-		log.Fatal(err)
+		//the scheduler records stderr as the run's error, see tasks.ErrorText
+		fmt.Fprintln(os.Stderr, tasks.ErrorText(err))
+		os.Exit(1)
+	}
+}
+
+/*
+runFunction calls Function with a context that is cancelled when the task
+is stopped (SIGINT, SIGTERM) or once timeout elapses. If Function does not
+return by then, or within the task's StopGrace after, the task exits with an error. A panic in Function is returned
+as a *tasks.PanicError, its stack is written to the task's log and to stderr so
+it ends up in the task's ErrorTxt. params are available to Function through
+tasks.RunParams(ctx).
+*/
+func runFunction(timeout time.Duration, params tasks.Params) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	ctx = tasks.WithParams(ctx, params)
+	task := tasks.NewTaskCtx(Function, nil)
+	task.Timeout = timeout
+	//panics in Function are recovered and their stack written to the task's log
+	logger, err := tasks.NewTaskLogger()
+	if err != nil {
+		log.Printf("task logger unavailable: %v", err)
+	} else {
+		task.Logger = logger
 	}
+	return task.RunContext(ctx)
 }
@@ -267,6 +267,9 @@ func IsInit() bool {
 
 func ParseTimeStr(t string) (time.Time, error) {
 	var layout string
+	if len(t) < 2 {
+		return time.Time{}, fmt.Errorf("incorrect time value: %v  should be in format 15:04 or 03:04PM", t)
+	}
 	tail := string(t[len(t)-2:])
 	if strings.EqualFold(tail, "AM") || strings.EqualFold(tail, "PM") {
 		layout = "03:04PM"
@@ -303,3 +306,21 @@ func DeleteTaskLog(logsPath string) error {
 	}
 	return os.RemoveAll(logsPath)
 }
+
+// GetTimeZone returns the location configured by TIME_ZONE in the workspace settings.
+// time.Local is returned when TIME_ZONE is not set.
+func GetTimeZone() (*time.Location, error) {
+	if _, ok := os.LookupEnv("TIME_ZONE"); !ok {
+		//settings may not exist e.g when running outside a workspace
+		_ = godotenv.Load(paths.WORKSPACE_SETTINGS)
+	}
+	tz := os.Getenv("TIME_ZONE")
+	if len(tz) == 0 {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TIME_ZONE %v: %v", tz, err)
+	}
+	return loc, nil
+}
@@ -0,0 +1,125 @@
+//go:build linux
+
+package watch
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MOVED_TO | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE
+
+// inotify watches directories with the linux inotify API
+type inotify struct {
+	//fd is kept as calling file.Fd() would switch the file to blocking mode
+	fd     int
+	file   *os.File
+	mu     sync.Mutex
+	dirs   map[string]int
+	paths  map[int]string
+	notify func(path string, op Op)
+	fail   func(err error)
+}
+
+func newBackend(notify func(path string, op Op), fail func(err error)) (backend, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+	//a non blocking fd is served by the runtime poller, so Close interrupts a pending Read
+	in := &inotify{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		dirs:   make(map[string]int),
+		paths:  make(map[int]string),
+		notify: notify,
+		fail:   fail,
+	}
+	go in.read()
+	return in, nil
+}
+
+func (in *inotify) add(dir string) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if _, ok := in.dirs[dir]; ok {
+		return nil
+	}
+	wd, err := syscall.InotifyAddWatch(in.fd, dir, inotifyMask|syscall.IN_ONLYDIR)
+	if err != nil {
+		return err
+	}
+	in.dirs[dir] = wd
+	in.paths[wd] = dir
+	return nil
+}
+
+func (in *inotify) remove(dir string) error {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	wd, ok := in.dirs[dir]
+	if !ok {
+		return nil
+	}
+	delete(in.dirs, dir)
+	delete(in.paths, wd)
+	if _, err := syscall.InotifyRmWatch(in.fd, uint32(wd)); err != nil && !errors.Is(err, syscall.EINVAL) {
+		return err
+	}
+	return nil
+}
+
+func (in *inotify) close() error {
+	return in.file.Close()
+}
+
+func (in *inotify) read() {
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := in.file.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			in.fail(fmt.Errorf("inotify read: %w", err))
+			return
+		}
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			offset = nameEnd
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				in.fail(fmt.Errorf("inotify queue overflow, file changes were missed"))
+				continue
+			}
+			if event.Len == 0 || event.Mask&syscall.IN_ISDIR != 0 {
+				continue
+			}
+			in.mu.Lock()
+			dir, ok := in.paths[int(event.Wd)]
+			in.mu.Unlock()
+			if !ok {
+				continue
+			}
+			name := string(buf[nameStart:nameEnd])
+			//the name is padded with NUL bytes
+			for i := 0; i < len(name); i++ {
+				if name[i] == 0 {
+					name = name[:i]
+					break
+				}
+			}
+			op := Write
+			if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+				op = Create
+			}
+			in.notify(filepath.Join(dir, name), op)
+		}
+	}
+}
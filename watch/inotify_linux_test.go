@@ -0,0 +1,124 @@
+//go:build linux
+
+package watch
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+const testDebounce = 50 * time.Millisecond
+
+func newTestWatcher(t *testing.T) *Watcher {
+	t.Helper()
+	w, err := NewWatcher()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { w.Close() })
+	return w
+}
+
+// nextEvent returns the next TriggerEvent, failing the test if none is emitted within wait
+func nextEvent(t *testing.T, w *Watcher, wait time.Duration) (TriggerEvent, bool) {
+	t.Helper()
+	select {
+	case event := <-w.Events():
+		return event, true
+	case err := <-w.Errors():
+		t.Fatal(err)
+	case <-time.After(wait):
+	}
+	return TriggerEvent{}, false
+}
+
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatcherMatchesGlob(t *testing.T) {
+	dir := t.TempDir()
+	w := newTestWatcher(t)
+	spec := &dto.ScheduleSpec{Type: "FileWatch", Glob: filepath.Join(dir, "*.csv"), FileEvent: dto.FileChanged, Debounce: testDebounce}
+	if err := w.Add("import", spec); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "notes.txt"), "ignored")
+	//names of different lengths are padded differently in inotify events
+	for _, name := range []string{"a.csv", "a-much-longer-file-name-than-the-previous-one.csv"} {
+		path := filepath.Join(dir, name)
+		writeFile(t, path, "1,2,3")
+		event, ok := nextEvent(t, w, time.Second)
+		if !ok {
+			t.Fatalf("no event for %v", path)
+		}
+		if event.Task != "import" || event.Path != path {
+			t.Fatalf("event = %+v, want task import & path %v", event, path)
+		}
+	}
+	if event, ok := nextEvent(t, w, 4*testDebounce); ok {
+		t.Fatalf("unexpected event %+v", event)
+	}
+}
+
+func TestWatcherDebounce(t *testing.T) {
+	dir := t.TempDir()
+	w := newTestWatcher(t)
+	spec := &dto.ScheduleSpec{Type: "FileWatch", Glob: filepath.Join(dir, "*.log"), FileEvent: dto.FileChanged, Debounce: 4 * testDebounce}
+	if err := w.Add("tail", spec); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "app.log")
+	for i := 0; i < 5; i++ {
+		writeFile(t, path, "line")
+		time.Sleep(testDebounce)
+	}
+	if _, ok := nextEvent(t, w, time.Second); !ok {
+		t.Fatal("no event once the file settled")
+	}
+	if event, ok := nextEvent(t, w, 6*testDebounce); ok {
+		t.Fatalf("writes were not debounced into one event, got another %+v", event)
+	}
+}
+
+func TestWatcherFileCreated(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "existing.csv")
+	writeFile(t, path, "old")
+	w := newTestWatcher(t)
+	spec := &dto.ScheduleSpec{Type: "FileWatch", Glob: filepath.Join(dir, "*.csv"), FileEvent: dto.FileCreated, Debounce: testDebounce}
+	if err := w.Add("import", spec); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, path, "new")
+	if event, ok := nextEvent(t, w, 4*testDebounce); ok {
+		t.Fatalf("write to an existing file triggered %+v", event)
+	}
+	created := filepath.Join(dir, "created.csv")
+	writeFile(t, created, "new")
+	event, ok := nextEvent(t, w, time.Second)
+	if !ok || event.Path != created {
+		t.Fatalf("event = %+v, want path %v", event, created)
+	}
+}
+
+func TestWatcherRemove(t *testing.T) {
+	dir := t.TempDir()
+	w := newTestWatcher(t)
+	spec := &dto.ScheduleSpec{Type: "FileWatch", Glob: filepath.Join(dir, "*"), Debounce: testDebounce}
+	if err := w.Add("any", spec); err != nil {
+		t.Fatal(err)
+	}
+	w.Remove("any")
+	writeFile(t, filepath.Join(dir, "file"), "data")
+	if event, ok := nextEvent(t, w, 4*testDebounce); ok {
+		t.Fatalf("removed trigger fired %+v", event)
+	}
+}
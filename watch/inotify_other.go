@@ -0,0 +1,12 @@
+//go:build !linux
+
+package watch
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func newBackend(notify func(path string, op Op), fail func(err error)) (backend, error) {
+	return nil, fmt.Errorf("file watching is not supported on %v", runtime.GOOS)
+}
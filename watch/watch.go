@@ -0,0 +1,252 @@
+package watch
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aodr3w/keiji-core/constants"
+	"github.com/aodr3w/keiji-core/dto"
+)
+
+// DefaultDebounce is used for FileWatch tasks that do not set a debounce
+const DefaultDebounce = 500 * time.Millisecond
+
+// Op is the kind of change reported for a file
+type Op int
+
+const (
+	//Create the file was created in or moved into the watched directory
+	Create Op = iota
+	//Write the file was written to
+	Write
+)
+
+/*
+TriggerEvent is emitted once a file matching a task's trigger has
+settled, i.e it has not changed for the trigger's debounce
+*/
+type TriggerEvent struct {
+	Task string
+	Path string
+	Time time.Time
+}
+
+// Env returns the environment passed to the task's process, see tasks.TriggerPath
+func (e TriggerEvent) Env() []string {
+	return []string{fmt.Sprintf("%s=%s", constants.TRIGGER_PATH_ENV, e.Path)}
+}
+
+// trigger is a task's file watch trigger
+type trigger struct {
+	task     string
+	dir      string
+	pattern  string
+	event    dto.FileEvent
+	debounce time.Duration
+}
+
+/*
+backend watches directories for changes to their files, which it reports
+through the notify function it is created with, see newBackend
+*/
+type backend interface {
+	add(dir string) error
+	remove(dir string) error
+	close() error
+}
+
+/*
+Watcher watches the directories of FileWatch tasks and emits a TriggerEvent
+for each matching file, see Add
+*/
+type Watcher struct {
+	backend  backend
+	events   chan TriggerEvent
+	errors   chan error
+	done     chan struct{}
+	mu       sync.Mutex
+	triggers map[string]*trigger
+	//pending holds a debounce timer per task & path
+	pending map[pendingKey]*time.Timer
+	closed  bool
+}
+
+/*
+NewWatcher returns a Watcher, failing on platforms without file watching support
+*/
+func NewWatcher() (*Watcher, error) {
+	w := &Watcher{
+		events:   make(chan TriggerEvent, 64),
+		errors:   make(chan error, 8),
+		done:     make(chan struct{}),
+		triggers: make(map[string]*trigger),
+		pending:  make(map[pendingKey]*time.Timer),
+	}
+	b, err := newBackend(w.notify, w.fail)
+	if err != nil {
+		return nil, err
+	}
+	w.backend = b
+	return w, nil
+}
+
+// Events returns the channel TriggerEvents are emitted on
+func (w *Watcher) Events() <-chan TriggerEvent {
+	return w.events
+}
+
+// Errors returns the channel errors reading file changes are emitted on
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+/*
+Add starts watching for the files that trigger the task called task, replacing
+any trigger it had before. spec is the task's schedule, a FileWatch schedule.
+*/
+func (w *Watcher) Add(task string, spec *dto.ScheduleSpec) error {
+	if len(spec.Glob) == 0 {
+		return fmt.Errorf("task %v has no file watch trigger", task)
+	}
+	dir, pattern := filepath.Split(filepath.Clean(spec.Glob))
+	dir = filepath.Clean(dir)
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return fmt.Errorf("task %v: invalid glob %q: %w", task, spec.Glob, err)
+	}
+	t := &trigger{
+		task:     task,
+		dir:      dir,
+		pattern:  pattern,
+		event:    spec.FileEvent,
+		debounce: spec.Debounce,
+	}
+	if t.debounce <= 0 {
+		t.debounce = DefaultDebounce
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return fmt.Errorf("watcher is closed")
+	}
+	if err := w.backend.add(dir); err != nil {
+		return fmt.Errorf("task %v: failed to watch %v: %w", task, dir, err)
+	}
+	previous := w.triggers[task]
+	w.triggers[task] = t
+	if previous != nil && previous.dir != dir {
+		w.unwatch(previous.dir)
+	}
+	return nil
+}
+
+// Remove stops watching for the files that trigger the task called task
+func (w *Watcher) Remove(task string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	t, ok := w.triggers[task]
+	if !ok {
+		return
+	}
+	delete(w.triggers, task)
+	for key, timer := range w.pending {
+		if key.task == task {
+			timer.Stop()
+			delete(w.pending, key)
+		}
+	}
+	w.unwatch(t.dir)
+}
+
+// unwatch stops watching dir unless another trigger uses it, w.mu must be held
+func (w *Watcher) unwatch(dir string) {
+	for _, t := range w.triggers {
+		if t.dir == dir {
+			return
+		}
+	}
+	if err := w.backend.remove(dir); err != nil {
+		w.fail(err)
+	}
+}
+
+// Close stops watching, pending TriggerEvents are dropped
+func (w *Watcher) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	for key, timer := range w.pending {
+		timer.Stop()
+		delete(w.pending, key)
+	}
+	close(w.done)
+	return w.backend.close()
+}
+
+/*
+notify is called by the backend for each change to a file, starting or
+extending the debounce of every trigger the file matches
+*/
+func (w *Watcher) notify(path string, op Op) {
+	dir, name := filepath.Split(path)
+	dir = filepath.Clean(dir)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return
+	}
+	for _, t := range w.triggers {
+		if t.dir != dir {
+			continue
+		}
+		if ok, _ := filepath.Match(t.pattern, name); !ok {
+			continue
+		}
+		key := pendingKey{t.task, path}
+		if timer, ok := w.pending[key]; ok {
+			//still changing, e.g a new file that is being written
+			timer.Reset(t.debounce)
+			continue
+		}
+		if t.event == dto.FileCreated && op != Create {
+			continue
+		}
+		task := t.task
+		w.pending[key] = time.AfterFunc(t.debounce, func() {
+			w.emit(key, TriggerEvent{Task: task, Path: path, Time: time.Now()})
+		})
+	}
+}
+
+func (w *Watcher) emit(key pendingKey, event TriggerEvent) {
+	w.mu.Lock()
+	if _, ok := w.pending[key]; !ok {
+		//removed or closed since the timer fired
+		w.mu.Unlock()
+		return
+	}
+	delete(w.pending, key)
+	w.mu.Unlock()
+	select {
+	case w.events <- event:
+	case <-w.done:
+	}
+}
+
+// fail is called by the backend when reading file changes fails
+func (w *Watcher) fail(err error) {
+	select {
+	case w.errors <- err:
+	default:
+		//errors are dropped if nobody is reading them
+	}
+}
+
+type pendingKey struct {
+	task string
+	path string
+}